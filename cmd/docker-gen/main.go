@@ -1,15 +1,18 @@
 package main
 
 import (
+	"expvar"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"slices"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	docker "github.com/fsouza/go-dockerclient"
@@ -28,6 +31,8 @@ var (
 	wait                  string
 	notifyCmd             string
 	notifyOutput          bool
+	notifyTimeout         time.Duration
+	notifyRetries         int
 	sighupContainerID     stringslice
 	notifyContainerID     stringslice
 	notifyContainerSignal int
@@ -46,6 +51,7 @@ var (
 	tlsKey                string
 	tlsCaCert             string
 	tlsVerify             bool
+	metricsAddr           string
 )
 
 func (strings *stringslice) String() string {
@@ -128,6 +134,8 @@ func initFlags() {
 	// Command notification options
 	flag.StringVar(&notifyCmd, "notify", "", "run command after template is regenerated (e.g `restart xyz`)")
 	flag.BoolVar(&notifyOutput, "notify-output", false, "log the output(stdout/stderr) of notify command")
+	flag.DurationVar(&notifyTimeout, "notify-timeout", 0, "kill the notify command if it runs longer than this duration (e.g. \"30s\")")
+	flag.IntVar(&notifyRetries, "notify-retries", 0, "number of times a failed notify command is retried, with an exponential backoff")
 	flag.IntVar(&interval, "interval", 0, "notify command interval (secs)")
 
 	// Containers notification options
@@ -147,6 +155,8 @@ func initFlags() {
 	flag.StringVar(&tlsCaCert, "tlscacert", filepath.Join(certPath, "ca.pem"), "path to TLS CA certificate file")
 	flag.BoolVar(&tlsVerify, "tlsverify", os.Getenv("DOCKER_TLS_VERIFY") != "", "verify docker daemon's TLS certicate")
 
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "address (e.g. \"127.0.0.1:9100\") serving metrics in the expvar format at /debug/vars")
+
 	flag.Var(&eventFilter, "event-filter",
 		"additional filter for event watched by docker-gen (e.g -event-filter event=connect -event-filter event=disconnect). You can pass this option multiple times to combine filters. By default docker-gen listen for container events start, stop, die and health_status. https://docs.docker.com/engine/reference/commandline/events/#filtering-events")
 
@@ -202,6 +212,8 @@ func main() {
 			Wait:             w,
 			NotifyCmd:        notifyCmd,
 			NotifyOutput:     notifyOutput,
+			NotifyTimeout:    notifyTimeout,
+			NotifyRetries:    notifyRetries,
 			NotifyContainers: make(map[string]int),
 			ContainerFilter:  containerFilter,
 			Interval:         interval,
@@ -242,6 +254,14 @@ func main() {
 		}
 	}
 
+	if metricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/debug/vars", expvar.Handler())
+			log.Fatal(http.ListenAndServe(metricsAddr, mux))
+		}()
+	}
+
 	generator, err := generator.NewGenerator(generator.GeneratorConfig{
 		Endpoint:              endpoint,
 		TLSKey:                tlsKey,
@@ -7,24 +7,56 @@ import (
 )
 
 type Config struct {
-	Template               string
-	Dest                   string
-	Watch                  bool
-	Wait                   *Wait
-	NotifyCmd              string
-	NotifyOutput           bool
-	NotifyContainers       map[string]int
-	NotifyContainersFilter map[string][]string
-	NotifyContainersSignal int
-	ContainerFilter        map[string][]string
-	Interval               int
-	KeepBlankLines         bool
+	Name                    string
+	Template                string
+	Dest                    string
+	Watch                   bool
+	Wait                    *Wait
+	NotifyCmd               string
+	NotifyOutput            bool
+	NotifyTimeout           time.Duration `toml:"notify_timeout"`
+	NotifyRetries           int           `toml:"notify_retries"`
+	NotifyMinInterval       time.Duration `toml:"notify_min_interval"`
+	NotifyContainers        map[string]int
+	NotifyContainersFilter  map[string][]string
+	NotifyContainersSignal  int
+	Notify                  []NotifyStep
+	ContainerFilter         map[string][]string
+	Interval                int
+	KeepBlankLines          bool
+	DriftCheck              time.Duration `toml:"drift_check"`
+	DriftAction             string        `toml:"drift_action"`
+	RollbackOnNotifyFailure bool          `toml:"rollback_on_notify_failure"`
+	PreRender               string        `toml:"pre_render"`
+	OnNoChange              string        `toml:"on_no_change"`
+	OnRenderError           string        `toml:"on_render_error"`
+	OnDockerDisconnect      string        `toml:"on_docker_disconnect"`
+	OnDockerReconnect       string        `toml:"on_docker_reconnect"`
 }
 
+const (
+	// DriftActionRestore rewrites a drifted destination with the last rendered contents and notifies again.
+	DriftActionRestore = "restore"
+	// DriftActionReport only logs the drift.
+	DriftActionReport = "report"
+)
+
 type ConfigFile struct {
 	Config []Config
 }
 
+// DisplayName returns the name of the config, defaulting to its destination
+// or, when writing to stdout, its template.
+func (c *Config) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if c.Dest != "" {
+		return c.Dest
+	}
+	return c.Template
+}
+
 func (c *ConfigFile) FilterWatches() ConfigFile {
 	configWithWatches := []Config{}
 
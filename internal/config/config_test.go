@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -59,3 +60,74 @@ func TestWaitUnmarshalText(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expectedWait, wait)
 }
+
+func TestNotifySteps(t *testing.T) {
+	cfg := Config{
+		NotifyCmd:              "nginx -s reload",
+		NotifyOutput:           true,
+		NotifyTimeout:          time.Minute,
+		NotifyRetries:          2,
+		NotifyContainers:       map[string]int{"nginx": 1, "app": -1},
+		NotifyContainersFilter: map[string][]string{"label": {"reload"}},
+		NotifyContainersSignal: 10,
+		Notify: []NotifyStep{
+			{Type: NotifySignal, Containers: []string{"haproxy"}, Signal: "SIGUSR2"},
+		},
+	}
+
+	expected := []NotifyStep{
+		{Type: NotifyCommand, Command: "nginx -s reload", Output: true, Timeout: time.Minute, Retries: 2, ContinueOnError: true},
+		{Type: NotifyRestart, Containers: []string{"app"}, ContinueOnError: true},
+		{Type: NotifySignal, Containers: []string{"nginx"}, Signal: "1", ContinueOnError: true},
+		{Type: NotifySignal, Filter: map[string][]string{"label": {"reload"}}, Signal: "10", ContinueOnError: true},
+		{Type: NotifySignal, Containers: []string{"haproxy"}, Signal: "SIGUSR2"},
+	}
+	assert.Equal(t, expected, cfg.NotifySteps())
+	assert.Empty(t, (&Config{}).NotifySteps())
+
+	cfg = Config{NotifyContainersFilter: map[string][]string{"label": {"reload"}}, NotifyContainersSignal: -1}
+	assert.Equal(t, []NotifyStep{
+		{Type: NotifySignal, Filter: map[string][]string{"label": {"reload"}}, Signal: "-1", ContinueOnError: true},
+	}, cfg.NotifySteps())
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := []NotifyStep{
+		{Type: NotifyCommand, Command: "true"},
+		{Type: NotifySignal, Containers: []string{"nginx"}, Signal: "HUP"},
+		{Type: NotifyRestart, Filter: map[string][]string{"name": {"nginx"}}, WaitHealthy: time.Minute},
+		{Type: NotifyPause, Containers: []string{"nginx"}},
+		{Type: NotifyServiceUpdate, Services: []string{"proxy"}},
+	}
+	for _, step := range valid {
+		cfg := Config{Notify: []NotifyStep{step}}
+		assert.NoError(t, cfg.Validate(), step.Type)
+	}
+
+	invalid := []NotifyStep{
+		{Type: "unknown"},
+		{Type: NotifyCommand},
+		{Type: NotifySignal, Containers: []string{"nginx"}, Signal: "SIGFOO"},
+		{Type: NotifySignal, Containers: []string{"nginx"}, Signal: "999"},
+		{Type: NotifySignal, Signal: "HUP"},
+		{Type: NotifyRestart},
+		{Type: NotifyStop, Containers: []string{"nginx"}, WaitHealthy: time.Minute},
+		{Type: NotifyServiceUpdate},
+	}
+	for _, step := range invalid {
+		cfg := Config{Notify: []NotifyStep{step}}
+		assert.Error(t, cfg.Validate(), step.Type)
+	}
+
+	assert.Error(t, (&Config{NotifyRetries: -1}).Validate())
+	assert.NoError(t, (&Config{Dest: "container://nginx:/etc/nginx/conf.d/default.conf"}).Validate())
+	assert.Error(t, (&Config{Dest: "container://nginx:etc/nginx/conf.d/default.conf"}).Validate())
+	assert.NoError(t, (&Config{Dest: "swarm-config://proxy-conf?service=proxy&keep=3"}).Validate())
+	assert.Error(t, (&Config{Dest: "swarm-config://proxy-conf?keep=0"}).Validate())
+
+	cfg := Config{DriftCheck: time.Minute}
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, DriftActionRestore, cfg.DriftAction)
+	assert.NoError(t, (&Config{DriftAction: DriftActionReport}).Validate())
+	assert.Error(t, (&Config{DriftAction: "ignore"}).Validate())
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ContainerDestScheme prefixes destinations inside a running container.
+	ContainerDestScheme = "container://"
+	// SwarmConfigDestScheme prefixes destinations published as Swarm configs.
+	SwarmConfigDestScheme = "swarm-config://"
+)
+
+// ContainerDest is a file inside a running container, addressed as
+// container://<name or ID>:<absolute path>.
+type ContainerDest struct {
+	Container string
+	Path      string
+}
+
+// ParseContainerDest parses a container:// destination.
+func ParseContainerDest(dest string) (ContainerDest, error) {
+	container, filePath, found := strings.Cut(strings.TrimPrefix(dest, ContainerDestScheme), ":")
+	if !found || container == "" || !path.IsAbs(filePath) || strings.HasSuffix(filePath, "/") {
+		return ContainerDest{}, fmt.Errorf("invalid container destination %q: expected %s<container>:<absolute file path>", dest, ContainerDestScheme)
+	}
+	return ContainerDest{Container: container, Path: path.Clean(filePath)}, nil
+}
+
+// SwarmConfigDest is a versioned Swarm config, addressed as
+// swarm-config://<name>[?service=<service>&target=<path>&keep=<count>].
+type SwarmConfigDest struct {
+	Name    string
+	Service string
+	Target  string
+	Keep    int
+}
+
+// ParseSwarmConfigDest parses a swarm-config:// destination, defaulting the
+// target to /<name> and keep to 2.
+func ParseSwarmConfigDest(dest string) (SwarmConfigDest, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return SwarmConfigDest{}, err
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") != "" {
+		return SwarmConfigDest{}, fmt.Errorf("invalid swarm config destination %q: expected %s<name>", dest, SwarmConfigDestScheme)
+	}
+
+	d := SwarmConfigDest{
+		Name:    u.Host,
+		Service: u.Query().Get("service"),
+		Target:  u.Query().Get("target"),
+		Keep:    2,
+	}
+	if d.Target == "" {
+		d.Target = "/" + d.Name
+	}
+	if keep := u.Query().Get("keep"); keep != "" {
+		d.Keep, err = strconv.Atoi(keep)
+		if err != nil || d.Keep < 1 {
+			return SwarmConfigDest{}, fmt.Errorf("invalid swarm config destination %q: keep must be a positive integer", dest)
+		}
+	}
+	return d, nil
+}
+
+// validateDest checks that a destination other than a local path is well formed.
+func validateDest(dest string) error {
+	var err error
+	switch {
+	case strings.HasPrefix(dest, ContainerDestScheme):
+		_, err = ParseContainerDest(dest)
+	case strings.HasPrefix(dest, SwarmConfigDestScheme):
+		_, err = ParseSwarmConfigDest(dest)
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nginx-proxy/docker-gen/internal/dockerclient"
+)
+
+const (
+	// NotifyCommand runs Command with /bin/sh -c.
+	NotifyCommand = "command"
+	// NotifySignal sends Signal to the target containers.
+	NotifySignal = "signal"
+	// NotifyRestart restarts the target containers.
+	NotifyRestart = "restart"
+	// NotifyStop stops the target containers.
+	NotifyStop = "stop"
+	// NotifyStart starts the target containers.
+	NotifyStart = "start"
+	// NotifyPause pauses the target containers.
+	NotifyPause = "pause"
+	// NotifyUnpause unpauses the target containers.
+	NotifyUnpause = "unpause"
+	// NotifyServiceUpdate forces an update of Services, rolling their tasks.
+	NotifyServiceUpdate = "service-update"
+	// NotifyExec runs Command with /bin/sh -c inside the target containers.
+	NotifyExec = "exec"
+	// NotifyHTTP posts a JSON description of the change to URL.
+	NotifyHTTP = "http"
+)
+
+// NotifyStep is one entry of the notification pipeline run after a config
+// destination changed, declared as a [[config.notify]] table.
+type NotifyStep struct {
+	Type string
+	// Command is the command run by a command or exec step.
+	Command string
+	// Output logs the output of the command.
+	Output bool
+	// Containers are the target containers, by name or ID.
+	Containers []string
+	// Filter selects additional target containers, like -notify-filter.
+	Filter map[string][]string
+	// Signal is the signal sent by a signal step, by name ("SIGHUP") or number.
+	Signal string
+	// Services are the Swarm services updated by a service-update step, by name or ID.
+	Services []string
+	// URL is the URL an http step posts to.
+	URL string
+	// Socket is the path of a unix socket an http step connects to instead of the URL host.
+	Socket string
+	// Headers are added to the request of an http step. Values are expanded
+	// with environment variables, so that secrets can stay out of config files.
+	Headers map[string]string
+	// Timeout limits the duration of each attempt of the step. For restart and
+	// stop steps, it is the time given to containers to stop before they are killed.
+	Timeout time.Duration
+	// WaitHealthy waits up to this duration for each target container to be
+	// healthy, or running if it has no health check, before going on.
+	WaitHealthy time.Duration `toml:"wait_healthy"`
+	// Retries is the number of times a failed step is retried, with an exponential backoff.
+	Retries int
+	// ContinueOnError runs the next steps even if this one fails.
+	ContinueOnError bool `toml:"continue_on_error"`
+}
+
+func (s NotifyStep) String() string {
+	switch s.Type {
+	case NotifyCommand:
+		return fmt.Sprintf("%s '%s'", s.Type, s.Command)
+	case NotifyExec:
+		return fmt.Sprintf("%s '%s' in %s", s.Type, s.Command, s.targets())
+	case NotifyHTTP:
+		if s.Socket != "" {
+			return fmt.Sprintf("%s %s via %s", s.Type, s.URL, s.Socket)
+		}
+		return fmt.Sprintf("%s %s", s.Type, s.URL)
+	case NotifySignal:
+		return fmt.Sprintf("%s %s to %s", s.Type, s.Signal, s.targets())
+	case NotifyServiceUpdate:
+		return fmt.Sprintf("%s %v", s.Type, s.Services)
+	default:
+		return fmt.Sprintf("%s %s", s.Type, s.targets())
+	}
+}
+
+func (s NotifyStep) targets() string {
+	targets := fmt.Sprint(s.Containers)
+	if len(s.Filter) > 0 {
+		targets += fmt.Sprintf(" and containers matching %v", s.Filter)
+	}
+	return targets
+}
+
+func (s NotifyStep) Validate() error {
+	if s.Retries < 0 {
+		return fmt.Errorf("%s step with negative retries", s.Type)
+	}
+	if s.WaitHealthy > 0 {
+		switch s.Type {
+		case NotifyCommand, NotifyHTTP, NotifyServiceUpdate, NotifyStop, NotifyPause:
+			return fmt.Errorf("%s step cannot wait for containers to be healthy", s.Type)
+		}
+	}
+
+	switch s.Type {
+	case NotifyCommand:
+		if s.Command == "" {
+			return errors.New("command step without a command")
+		}
+		return nil
+	case NotifyHTTP:
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("http step with invalid URL %q", s.URL)
+		}
+		return nil
+	case NotifyServiceUpdate:
+		if len(s.Services) == 0 {
+			return errors.New("service-update step without services")
+		}
+		return nil
+	case NotifySignal:
+		if _, err := dockerclient.ParseSignal(s.Signal); err != nil {
+			return err
+		}
+	case NotifyExec:
+		if s.Command == "" {
+			return errors.New("exec step without a command")
+		}
+	case NotifyRestart, NotifyStop, NotifyStart, NotifyPause, NotifyUnpause:
+	default:
+		return fmt.Errorf("unknown notify type %q", s.Type)
+	}
+	if len(s.Containers) == 0 && len(s.Filter) == 0 {
+		return fmt.Errorf("%s step without containers or filter", s.Type)
+	}
+	return nil
+}
+
+// NotifySteps returns the notification pipeline of the config: the steps
+// equivalent to the legacy NotifyCmd, NotifyContainers and NotifyContainersFilter
+// keys, which always all run, followed by the [[config.notify]] steps.
+func (c *Config) NotifySteps() []NotifyStep {
+	var steps []NotifyStep
+
+	if c.NotifyCmd != "" {
+		steps = append(steps, NotifyStep{
+			Type:            NotifyCommand,
+			Command:         c.NotifyCmd,
+			Output:          c.NotifyOutput,
+			Timeout:         c.NotifyTimeout,
+			Retries:         c.NotifyRetries,
+			ContinueOnError: true,
+		})
+	}
+
+	containers := make([]string, 0, len(c.NotifyContainers))
+	for container := range c.NotifyContainers {
+		containers = append(containers, container)
+	}
+	sort.Strings(containers)
+	for _, container := range containers {
+		steps = append(steps, legacySignalStep(c.NotifyContainers[container], []string{container}, nil))
+	}
+
+	if len(c.NotifyContainersFilter) > 0 {
+		steps = append(steps, legacySignalStep(c.NotifyContainersSignal, nil, c.NotifyContainersFilter))
+	}
+
+	return append(steps, c.Notify...)
+}
+
+// legacySignalStep converts a legacy signal number, where -1 means restart, into a step.
+// Filtered containers keep a signal step, so that their labels can still
+// override the restart.
+func legacySignalStep(signal int, containers []string, filter map[string][]string) NotifyStep {
+	step := NotifyStep{
+		Type:            NotifySignal,
+		Containers:      containers,
+		Filter:          filter,
+		Signal:          strconv.Itoa(signal),
+		ContinueOnError: true,
+	}
+	if signal == -1 && filter == nil {
+		step.Type = NotifyRestart
+		step.Signal = ""
+	}
+	return step
+}
+
+// Validate checks the notification steps of the config.
+func (c *Config) Validate() error {
+	if c.NotifyRetries < 0 {
+		return errors.New("negative notify_retries")
+	}
+	if err := validateDest(c.Dest); err != nil {
+		return err
+	}
+	switch c.DriftAction {
+	case "":
+		c.DriftAction = DriftActionRestore
+	case DriftActionRestore, DriftActionReport:
+	default:
+		return fmt.Errorf("invalid drift_action %q: must be %q or %q", c.DriftAction, DriftActionRestore, DriftActionReport)
+	}
+	for i, step := range c.Notify {
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("notify step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
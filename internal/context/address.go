@@ -1,6 +1,8 @@
 package context
 
 import (
+	"fmt"
+	"net"
 	"sort"
 	"strconv"
 
@@ -15,6 +17,14 @@ type Address struct {
 	HostPort     string
 	Proto        string
 	HostIP       string
+	// Bindings lists every host binding of the port. HostIP and HostPort are
+	// those of the first one.
+	Bindings []PortBinding
+}
+
+type PortBinding struct {
+	HostIP   string
+	HostPort string
 }
 
 func renderAddress(container *docker.Container, port docker.Port) Address {
@@ -41,6 +51,12 @@ func GetContainerAddresses(container *docker.Container) []Address {
 				address.HostPort = bindings[0].HostPort
 				address.HostIP = bindings[0].HostIP
 			}
+			for _, binding := range bindings {
+				address.Bindings = append(address.Bindings, PortBinding{
+					HostIP:   binding.HostIP,
+					HostPort: binding.HostPort,
+				})
+			}
 
 			addresses = append(addresses, address)
 		}
@@ -80,3 +96,88 @@ func sortAddresses(addresses []Address) {
 		return a.IP < b.IP
 	})
 }
+
+// PortRange is a range of consecutive container ports bound to a range of
+// consecutive host ports, or not published.
+type PortRange struct {
+	Proto string
+	Start int
+	End   int
+	// HostIP, HostStart and HostEnd are empty for ports that are not published.
+	HostIP    string
+	HostStart int
+	HostEnd   int
+}
+
+// String returns the range as in docker run -p, such as
+// "0.0.0.0:8000-8010:8000-8010/tcp", or "8000-8010/tcp" if not published.
+func (r PortRange) String() string {
+	ports := formatPortRange(r.Start, r.End) + "/" + r.Proto
+	if r.HostStart == 0 {
+		return ports
+	}
+	hostPorts := formatPortRange(r.HostStart, r.HostEnd)
+	if r.HostIP != "" {
+		hostPorts = net.JoinHostPort(r.HostIP, hostPorts)
+	}
+	return hostPorts + ":" + ports
+}
+
+func formatPortRange(start, end int) string {
+	if start == end {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d-%d", start, end)
+}
+
+// PortRanges returns the addresses of the container, with each binding
+// apart, as ranges of consecutive ports.
+func (r *RuntimeContainer) PortRanges() []PortRange {
+	var ports []PortRange
+	for _, address := range r.Addresses {
+		port, err := strconv.Atoi(address.Port)
+		if err != nil {
+			continue
+		}
+		if len(address.Bindings) == 0 {
+			ports = append(ports, PortRange{Proto: address.Proto, Start: port, End: port})
+		}
+		for _, binding := range address.Bindings {
+			hostPort, _ := strconv.Atoi(binding.HostPort)
+			ports = append(ports, PortRange{
+				Proto:     address.Proto,
+				Start:     port,
+				End:       port,
+				HostIP:    binding.HostIP,
+				HostStart: hostPort,
+				HostEnd:   hostPort,
+			})
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i], ports[j]
+		if a.Proto != b.Proto {
+			return a.Proto < b.Proto
+		}
+		if a.HostIP != b.HostIP {
+			return a.HostIP < b.HostIP
+		}
+		return a.Start < b.Start
+	})
+
+	var ranges []PortRange
+	for _, port := range ports {
+		if n := len(ranges); n > 0 {
+			last := &ranges[n-1]
+			consecutiveHost := port.HostStart == 0 && last.HostEnd == 0 || port.HostStart == last.HostEnd+1
+			if port.Proto == last.Proto && port.HostIP == last.HostIP && port.Start == last.End+1 && consecutiveHost {
+				last.End = port.End
+				last.HostEnd = port.HostEnd
+				continue
+			}
+		}
+		ranges = append(ranges, port)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	return ranges
+}
@@ -1,6 +1,8 @@
 package context
 
 import (
+	"fmt"
+	"strconv"
 	"testing"
 
 	docker "github.com/fsouza/go-dockerclient"
@@ -45,6 +47,7 @@ func TestGenerateContainerAddresses(t *testing.T) {
 		Proto:        "tcp",
 		HostIP:       "100.100.100.100",
 		HostPort:     "8080",
+		Bindings:     []PortBinding{{HostIP: "100.100.100.100", HostPort: "8080"}},
 	})
 	assert.Contains(t, addresses, Address{
 		IP:           "10.0.0.10",
@@ -174,3 +177,53 @@ func TestGetContainerAddressesNilStructs(t *testing.T) {
 	testContainer := &docker.Container{Config: nil, NetworkSettings: nil}
 	assert.Empty(t, GetContainerAddresses(testContainer))
 }
+
+func TestGetContainerAddressesMultipleBindings(t *testing.T) {
+	testContainer := &docker.Container{
+		NetworkSettings: &docker.NetworkSettings{
+			Ports: map[docker.Port][]docker.PortBinding{
+				httpPort: {{HostIP: "0.0.0.0", HostPort: "8080"}, {HostIP: "::", HostPort: "8080"}},
+			},
+		},
+	}
+
+	addresses := GetContainerAddresses(testContainer)
+	assert.Equal(t, []Address{{
+		Port:     "80",
+		Proto:    "tcp",
+		HostIP:   "0.0.0.0",
+		HostPort: "8080",
+		Bindings: []PortBinding{{HostIP: "0.0.0.0", HostPort: "8080"}, {HostIP: "::", HostPort: "8080"}},
+	}}, addresses)
+}
+
+func TestPortRanges(t *testing.T) {
+	ports := map[docker.Port][]docker.PortBinding{
+		"53/udp":  {},
+		"443/tcp": {{HostIP: "0.0.0.0", HostPort: "443"}, {HostIP: "::", HostPort: "443"}},
+	}
+	for port := 8000; port <= 8010; port++ {
+		ports[docker.Port(fmt.Sprintf("%d/tcp", port))] = []docker.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(port + 1000)}}
+	}
+	// 9000 is not bound to the next host port of 8999, so it starts a new range.
+	ports["8999/tcp"] = []docker.PortBinding{{HostIP: "0.0.0.0", HostPort: "18999"}}
+	ports["9000/tcp"] = []docker.PortBinding{{HostIP: "0.0.0.0", HostPort: "9000"}}
+
+	container := &RuntimeContainer{
+		Addresses: GetContainerAddresses(&docker.Container{NetworkSettings: &docker.NetworkSettings{Ports: ports}}),
+	}
+	ranges := container.PortRanges()
+	var formatted []string
+	for _, r := range ranges {
+		formatted = append(formatted, r.String())
+	}
+	assert.Equal(t, []string{
+		"53/udp",
+		"0.0.0.0:443:443/tcp",
+		"[::]:443:443/tcp",
+		"0.0.0.0:9000-9010:8000-8010/tcp",
+		"0.0.0.0:18999:8999/tcp",
+		"0.0.0.0:9000:9000/tcp",
+	}, formatted)
+	assert.Equal(t, PortRange{Proto: "tcp", Start: 8000, End: 8010, HostIP: "0.0.0.0", HostStart: 9000, HostEnd: 9010}, ranges[3])
+}
@@ -0,0 +1,133 @@
+package context
+
+import (
+	"reflect"
+	"sort"
+)
+
+// ContainerRef identifies a container in a change set.
+type ContainerRef struct {
+	ID   string
+	Name string
+	// Fields lists the RuntimeContainer fields that differ, for changed containers.
+	Fields []string
+}
+
+// Changes lists the containers added, removed and changed between two
+// consecutive renders of a config.
+type Changes struct {
+	Added   []ContainerRef
+	Removed []ContainerRef
+	Changed []ContainerRef
+}
+
+// Empty reports whether no container was added, removed or changed.
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// Merge returns the net changes of c followed by later, for instance a
+// container added by c and removed by later is not listed at all.
+func (c Changes) Merge(later Changes) Changes {
+	const (
+		added = iota + 1
+		removed
+		changed
+	)
+	kinds := make(map[string]int)
+	refs := make(map[string]ContainerRef)
+	var ids []string
+	for _, changes := range []Changes{c, later} {
+		for kind, list := range [][]ContainerRef{added: changes.Added, removed: changes.Removed, changed: changes.Changed} {
+			for _, ref := range list {
+				if _, found := refs[ref.ID]; !found {
+					ids = append(ids, ref.ID)
+				}
+				refs[ref.ID] = ref
+
+				switch previous := kinds[ref.ID]; {
+				case previous == added && kind == removed:
+					kinds[ref.ID] = 0
+				case previous == added:
+				case previous == removed && kind == added:
+					kinds[ref.ID] = changed
+				default:
+					kinds[ref.ID] = kind
+				}
+			}
+		}
+	}
+
+	var merged Changes
+	for _, id := range ids {
+		switch kinds[id] {
+		case added:
+			merged.Added = append(merged.Added, refs[id])
+		case removed:
+			merged.Removed = append(merged.Removed, refs[id])
+		case changed:
+			merged.Changed = append(merged.Changed, refs[id])
+		}
+	}
+	merged.sort()
+	return merged
+}
+
+// stable returns a copy of c without the health check results, which change
+// on every check and would otherwise make a container differ each time.
+func stable(c *RuntimeContainer) RuntimeContainer {
+	result := *c
+	result.State.Health.FailingStreak = 0
+	result.State.Health.Log = nil
+	return result
+}
+
+// changedFields returns the names of the fields that differ between a and b.
+func changedFields(a, b RuntimeContainer) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	var fields []string
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			fields = append(fields, va.Type().Field(i).Name)
+		}
+	}
+	return fields
+}
+
+func (c Changes) sort() {
+	for _, refs := range [][]ContainerRef{c.Added, c.Removed, c.Changed} {
+		sort.Slice(refs, func(i, j int) bool {
+			return refs[i].Name < refs[j].Name
+		})
+	}
+}
+
+// DiffContainers computes the changes from previous to current, matching containers by ID.
+func DiffContainers(previous, current []*RuntimeContainer) Changes {
+	before := make(map[string]*RuntimeContainer, len(previous))
+	for _, c := range previous {
+		before[c.ID] = c
+	}
+
+	var changes Changes
+	seen := make(map[string]bool, len(current))
+	for _, c := range current {
+		seen[c.ID] = true
+		old, found := before[c.ID]
+		if !found {
+			changes.Added = append(changes.Added, ContainerRef{ID: c.ID, Name: c.Name})
+			continue
+		}
+		if fields := changedFields(stable(old), stable(c)); len(fields) > 0 {
+			changes.Changed = append(changes.Changed, ContainerRef{ID: c.ID, Name: c.Name, Fields: fields})
+		}
+	}
+	for _, c := range previous {
+		if !seen[c.ID] {
+			changes.Removed = append(changes.Removed, ContainerRef{ID: c.ID, Name: c.Name})
+		}
+	}
+
+	changes.sort()
+	return changes
+}
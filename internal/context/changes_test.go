@@ -0,0 +1,48 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffContainers(t *testing.T) {
+	previous := []*RuntimeContainer{
+		{ID: "1", Name: "kept"},
+		{ID: "2", Name: "removed"},
+		{ID: "3", Name: "changed", State: State{Running: true}},
+	}
+	current := []*RuntimeContainer{
+		{ID: "1", Name: "kept"},
+		{ID: "3", Name: "changed", State: State{Running: false}, Labels: map[string]string{"a": "b"}},
+		{ID: "5", Name: "b-added"},
+		{ID: "4", Name: "a-added"},
+	}
+
+	changes := DiffContainers(previous, current)
+	assert.Equal(t, []ContainerRef{{ID: "4", Name: "a-added"}, {ID: "5", Name: "b-added"}}, changes.Added)
+	assert.Equal(t, []ContainerRef{{ID: "2", Name: "removed"}}, changes.Removed)
+	assert.Equal(t, []ContainerRef{{ID: "3", Name: "changed", Fields: []string{"Labels", "State"}}}, changes.Changed)
+	assert.False(t, changes.Empty())
+
+	assert.True(t, DiffContainers(current, current).Empty())
+
+	checked := []*RuntimeContainer{{ID: "1", State: State{Health: Health{Status: "healthy", Log: []HealthLog{{Output: "ok"}}}}}}
+	rechecked := []*RuntimeContainer{{ID: "1", State: State{Health: Health{Status: "healthy", Log: []HealthLog{{Output: "ok"}, {Output: "ok"}}}}}}
+	assert.True(t, DiffContainers(checked, rechecked).Empty(), "health check results are not a change")
+	assert.Equal(t, []ContainerRef{{ID: "1", Name: "kept"}}, DiffContainers(nil, current[:1]).Added)
+}
+
+func TestChangesMerge(t *testing.T) {
+	a, b, c, d := ContainerRef{ID: "1", Name: "a"}, ContainerRef{ID: "2", Name: "b"}, ContainerRef{ID: "3", Name: "c"}, ContainerRef{ID: "4", Name: "d"}
+	first := Changes{Added: []ContainerRef{a, b}, Removed: []ContainerRef{c}, Changed: []ContainerRef{d}}
+	later := Changes{Removed: []ContainerRef{a, d}, Added: []ContainerRef{c}, Changed: []ContainerRef{b}}
+
+	assert.Equal(t, Changes{
+		Added:   []ContainerRef{b},
+		Removed: []ContainerRef{d},
+		Changed: []ContainerRef{c},
+	}, first.Merge(later))
+	assert.Equal(t, first, Changes{}.Merge(first))
+	assert.True(t, Changes{}.Merge(Changes{}).Empty())
+}
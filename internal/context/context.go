@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -39,19 +41,66 @@ func (c *Context) CurrentContainer() *RuntimeContainer {
 	return currentContainer
 }
 
-func SetServerInfo(d *docker.DockerInfo) {
+// RenderData is what templates know about a render besides its containers,
+// available through the methods of Context.
+type RenderData struct {
+	Changes Changes
+}
+
+// renders holds the RenderData bound to the contexts being rendered.
+var renders sync.Map
+
+// Bind makes data available through the methods of c until unbind is called.
+func (c *Context) Bind(data RenderData) (unbind func()) {
+	renders.Store(c, data)
+	return func() { renders.Delete(c) }
+}
+
+func (c *Context) renderData() RenderData {
+	data, _ := renders.Load(c)
+	renderData, _ := data.(RenderData)
+	return renderData
+}
+
+// Changes returns the containers added, removed and changed since the
+// previous render of the config.
+func (c *Context) Changes() Changes {
+	return c.renderData().Changes
+}
+
+func SetServerInfo(d *docker.DockerInfo, swarm DockerSwarm) {
 	mu.Lock()
 	defer mu.Unlock()
 	dockerInfo = Docker{
-		Name:            d.Name,
-		NumContainers:   d.Containers,
-		NumImages:       d.Images,
-		Version:         dockerEnv.Get("Version"),
-		ApiVersion:      dockerEnv.Get("ApiVersion"),
-		GoVersion:       dockerEnv.Get("GoVersion"),
-		OperatingSystem: dockerEnv.Get("Os"),
-		Architecture:    dockerEnv.Get("Arch"),
+		Name:               d.Name,
+		NumContainers:      d.Containers,
+		NumImages:          d.Images,
+		Version:            dockerEnv.Get("Version"),
+		ApiVersion:         dockerEnv.Get("ApiVersion"),
+		GoVersion:          dockerEnv.Get("GoVersion"),
+		OperatingSystem:    dockerEnv.Get("Os"),
+		Architecture:       dockerEnv.Get("Arch"),
+		CurrentContainerID: dockerInfo.CurrentContainerID,
+		ID:                 d.ID,
+		Labels:             utils.SplitKeyValueSlice(d.Labels),
+		NCPU:               d.NCPU,
+		MemTotal:           d.MemTotal,
+		KernelVersion:      d.KernelVersion,
+		StorageDriver:      d.Driver,
+		LoggingDriver:      d.LoggingDriver,
+		CgroupDriver:       d.CgroupDriver,
+		DefaultRuntime:     d.DefaultRuntime,
+		SecurityOptions:    d.SecurityOptions,
+		Rootless:           slices.Contains(d.SecurityOptions, "name=rootless"),
+		Swarm:              swarm,
+	}
+	if d.RegistryConfig != nil {
+		dockerInfo.RegistryMirrors = d.RegistryConfig.Mirrors
 	}
+	for runtime := range d.Runtimes {
+		dockerInfo.Runtimes = append(dockerInfo.Runtimes, runtime)
+	}
+	sort.Strings(dockerInfo.Runtimes)
 }
 
 func SetDockerEnv(d *docker.Env) {
@@ -84,6 +133,34 @@ type Network struct {
 	GlobalIPv6PrefixLen int
 	IPPrefixLen         int
 	Internal            bool
+	ID                  string
+	DNSNames            []string
+	// LinkLocalIPs are the link-local addresses requested for the endpoint.
+	LinkLocalIPs []string
+	// The following fields come from the network itself.
+	Driver     string
+	Scope      string
+	EnableIPv6 bool
+	Attachable bool
+	Ingress    bool
+	IPAM       IPAM
+	Labels     map[string]string
+	Options    map[string]string
+}
+
+// IPAM is the IP address management configuration of a network.
+type IPAM struct {
+	Driver string
+	// Config holds the IPv4 and IPv6 pools of the network.
+	Config  []IPAMConfig
+	Options map[string]string
+}
+
+type IPAMConfig struct {
+	Subnet       string
+	IPRange      string
+	Gateway      string
+	AuxAddresses map[string]string
 }
 
 type Device struct {
@@ -99,12 +176,46 @@ type Volume struct {
 }
 
 type State struct {
-	Running bool
-	Health  Health
+	// Status is one of created, running, paused, restarting, removing, exited or dead.
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Dead       bool
+	Pid        int
+	ExitCode   int
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Health     Health
 }
 
 type Health struct {
-	Status string
+	// Status is one of starting, healthy or unhealthy, or empty without a health check.
+	Status        string
+	FailingStreak int
+	// Log holds the results of the last health checks, as kept by Docker.
+	Log    []HealthLog
+	Config HealthConfig
+}
+
+type HealthLog struct {
+	Start    time.Time
+	End      time.Time
+	ExitCode int
+	Output   string
+}
+
+// HealthConfig is the health check configured for the container, including
+// the one inherited from its image.
+type HealthConfig struct {
+	Test          []string
+	Interval      time.Duration
+	Timeout       time.Duration
+	StartPeriod   time.Duration
+	StartInterval time.Duration
+	Retries       int
 }
 
 type RuntimeContainer struct {
@@ -118,6 +229,7 @@ type RuntimeContainer struct {
 	Hostname     string
 	NetworkMode  string
 	Image        DockerImage
+	ImageDetails *ImageInfo // from the inspection of the image, nil if it failed
 	Env          map[string]string
 	Volumes      map[string]Volume
 	Node         SwarmNode
@@ -127,6 +239,66 @@ type RuntimeContainer struct {
 	IP6Global    string
 	Mounts       []Mount
 	State        State
+	// Path and Args are the process run in the container, resolved from
+	// Entrypoint and Command.
+	Path          string
+	Args          []string
+	Command       []string
+	Entrypoint    []string
+	User          string
+	WorkingDir    string
+	RestartPolicy RestartPolicy
+	RestartCount  int
+	Platform      string
+	StopSignal    string
+	Resources     Resources
+	// LogPath is the file the logs of the container are written to, empty
+	// for logging drivers that do not write to a file.
+	LogPath   string
+	LogConfig LogConfig
+}
+
+type LogConfig struct {
+	// Driver is the logging driver, such as json-file, local, syslog or gelf.
+	Driver  string
+	Options map[string]string
+}
+
+// Resources holds the resource limits and security settings of a container.
+// Zero values mean no limit.
+type Resources struct {
+	// Memory, MemoryReservation, MemorySwap and ShmSize are in bytes.
+	Memory            int64
+	MemoryReservation int64
+	MemorySwap        int64
+	// NanoCPUs is the CPU quota in units of 1e-9 CPUs.
+	NanoCPUs       int64
+	CPUShares      int64
+	CPUQuota       int64
+	CPUPeriod      int64
+	CPUSetCPUs     string
+	CPUSetMems     string
+	PidsLimit      int64
+	Ulimits        []Ulimit
+	Sysctls        map[string]string
+	ShmSize        int64
+	CapAdd         []string
+	CapDrop        []string
+	Privileged     bool
+	ReadonlyRootfs bool
+	SecurityOpt    []string
+}
+
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+type RestartPolicy struct {
+	// Name is one of no, always, unless-stopped or on-failure.
+	Name              string
+	MaximumRetryCount int
 }
 
 func (r *RuntimeContainer) Equals(o RuntimeContainer) bool {
@@ -134,9 +306,35 @@ func (r *RuntimeContainer) Equals(o RuntimeContainer) bool {
 }
 
 type DockerImage struct {
+	// Registry and Repository are as written in the image reference of the
+	// container, see Domain and Path for their normalized form.
 	Registry   string
 	Repository string
 	Tag        string
+	Digest     string
+	// Domain is the registry, defaulting to docker.io.
+	Domain string
+	// Path is the repository in the registry, such as library/nginx.
+	Path string
+	// FamiliarName is the name shown by the Docker CLI, such as nginx.
+	FamiliarName string
+	// Canonical is the fully qualified reference, such as
+	// docker.io/library/nginx:1.27@sha256:...
+	Canonical string
+}
+
+// ImageInfo holds the details of an image from its inspection. It is kept
+// apart from DockerImage so that images remain comparable in templates.
+type ImageInfo struct {
+	ID           string
+	RepoDigests  []string
+	Created      time.Time
+	Architecture string
+	OS           string
+	Labels       map[string]string
+	// ExposedPorts and Env are the defaults set by the image.
+	ExposedPorts []string
+	Env          map[string]string
 }
 
 func (i *DockerImage) String() string {
@@ -147,6 +345,9 @@ func (i *DockerImage) String() string {
 	if i.Tag != "" {
 		ret = ret + ":" + i.Tag
 	}
+	if i.Digest != "" {
+		ret = ret + "@" + i.Digest
+	}
 	return ret
 }
 
@@ -175,6 +376,37 @@ type Docker struct {
 	OperatingSystem    string
 	Architecture       string
 	CurrentContainerID string
+	ID                 string
+	Labels             map[string]string
+	NCPU               int
+	// MemTotal is in bytes.
+	MemTotal        int64
+	KernelVersion   string
+	StorageDriver   string
+	LoggingDriver   string
+	CgroupDriver    string
+	RegistryMirrors []string
+	// Runtimes lists the names of the OCI runtimes of the daemon.
+	Runtimes        []string
+	DefaultRuntime  string
+	SecurityOptions []string
+	Rootless        bool
+	Swarm           DockerSwarm
+}
+
+// DockerSwarm is the Swarm state of the Docker daemon.
+type DockerSwarm struct {
+	NodeID   string
+	NodeAddr string
+	// LocalNodeState is one of inactive, pending, active, error or locked.
+	LocalNodeState string
+	// Role is manager or worker, or empty if the node is not in a swarm.
+	Role string
+	// ClusterID, Leader and Reachability are only known on managers.
+	ClusterID string
+	Leader    bool
+	// Reachability is one of reachable, unreachable or unknown.
+	Reachability string
 }
 
 // GetCurrentContainerID attempts to extract the current container ID from the provided file paths.
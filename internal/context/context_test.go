@@ -300,4 +300,7 @@ func TestDockerImageString(t *testing.T) {
 
 	image.Registry = ""
 	assert.Equal(t, "foo/bar:qux", image.String())
+
+	image.Digest = "sha256:0c86dddac19f2ce4fd716ac58c0fd87bf69bfd4edabfd6971fb885bafd12a00b"
+	assert.Equal(t, "foo/bar:qux@sha256:0c86dddac19f2ce4fd716ac58c0fd87bf69bfd4edabfd6971fb885bafd12a00b", image.String())
 }
@@ -0,0 +1,91 @@
+package context
+
+import (
+	"slices"
+	"strings"
+)
+
+var (
+	dockerNetworks []DockerNetwork
+	dockerVolumes  []DockerVolume
+)
+
+// DockerNetwork is a network of the Docker host.
+type DockerNetwork struct {
+	ID         string
+	Name       string
+	Driver     string
+	Scope      string
+	Internal   bool
+	EnableIPv6 bool
+	Attachable bool
+	Ingress    bool
+	IPAM       IPAM
+	Labels     map[string]string
+	Options    map[string]string
+	// Containers lists the IDs of the containers of the context attached to the network.
+	Containers []string
+}
+
+// DockerVolume is a volume of the Docker host.
+type DockerVolume struct {
+	Name       string
+	Driver     string
+	Mountpoint string
+	Labels     map[string]string
+	Options    map[string]string
+	// Containers lists the IDs of the containers of the context mounting the volume.
+	Containers []string
+}
+
+func SetNetworks(networks []DockerNetwork) {
+	mu.Lock()
+	defer mu.Unlock()
+	dockerNetworks = networks
+}
+
+func SetVolumes(volumes []DockerVolume) {
+	mu.Lock()
+	defer mu.Unlock()
+	dockerVolumes = volumes
+}
+
+// Networks returns every network of the Docker host, sorted by name, including
+// those no container is attached to.
+func (c *Context) Networks() []DockerNetwork {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	networks := make([]DockerNetwork, 0, len(dockerNetworks))
+	for _, network := range dockerNetworks {
+		network.Containers = nil
+		for _, container := range *c {
+			if slices.ContainsFunc(container.Networks, func(n Network) bool { return n.Name == network.Name }) {
+				network.Containers = append(network.Containers, container.ID)
+			}
+		}
+		networks = append(networks, network)
+	}
+	slices.SortFunc(networks, func(a, b DockerNetwork) int { return strings.Compare(a.Name, b.Name) })
+	return networks
+}
+
+// Volumes returns every volume of the Docker host, sorted by name, including
+// those no container mounts.
+func (c *Context) Volumes() []DockerVolume {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	volumes := make([]DockerVolume, 0, len(dockerVolumes))
+	for _, volume := range dockerVolumes {
+		volume.Containers = nil
+		for _, container := range *c {
+			if slices.ContainsFunc(container.Mounts, func(m Mount) bool { return m.Name == volume.Name }) {
+				volume.Containers = append(volume.Containers, container.ID)
+			}
+		}
+		volumes = append(volumes, volume)
+	}
+	slices.SortFunc(volumes, func(a, b DockerVolume) int { return strings.Compare(a.Name, b.Name) })
+	return volumes
+}
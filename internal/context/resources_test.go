@@ -0,0 +1,47 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworks(t *testing.T) {
+	SetNetworks([]DockerNetwork{
+		{ID: "2", Name: "frontend", Driver: "bridge"},
+		{ID: "1", Name: "backend", Driver: "bridge", IPAM: IPAM{Config: []IPAMConfig{{Subnet: "172.20.0.0/16"}}}},
+		{ID: "3", Name: "unused", Driver: "overlay"},
+	})
+	t.Cleanup(func() { SetNetworks(nil) })
+
+	c := Context{
+		{ID: "a", Networks: []Network{{Name: "backend"}, {Name: "frontend"}}},
+		{ID: "b", Networks: []Network{{Name: "backend"}}},
+	}
+	assert.Equal(t, []DockerNetwork{
+		{ID: "1", Name: "backend", Driver: "bridge", IPAM: IPAM{Config: []IPAMConfig{{Subnet: "172.20.0.0/16"}}}, Containers: []string{"a", "b"}},
+		{ID: "2", Name: "frontend", Driver: "bridge", Containers: []string{"a"}},
+		{ID: "3", Name: "unused", Driver: "overlay"},
+	}, c.Networks())
+
+	var empty Context
+	assert.Len(t, empty.Networks(), 3)
+	assert.Empty(t, empty.Networks()[0].Containers)
+}
+
+func TestVolumes(t *testing.T) {
+	SetVolumes([]DockerVolume{
+		{Name: "logs", Driver: "local", Mountpoint: "/var/lib/docker/volumes/logs/_data"},
+		{Name: "data", Driver: "local"},
+	})
+	t.Cleanup(func() { SetVolumes(nil) })
+
+	c := Context{
+		{ID: "a", Mounts: []Mount{{Name: "logs", Destination: "/var/log/nginx"}, {Source: "/etc/nginx", Destination: "/etc/nginx"}}},
+		{ID: "b", Mounts: []Mount{{Name: "logs", Destination: "/logs"}}},
+	}
+	assert.Equal(t, []DockerVolume{
+		{Name: "data", Driver: "local"},
+		{Name: "logs", Driver: "local", Mountpoint: "/var/lib/docker/volumes/logs/_data", Containers: []string{"a", "b"}},
+	}, c.Volumes())
+}
@@ -0,0 +1,147 @@
+package dockerclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// APIClient is a raw Docker API client for the endpoints and fields that
+// go-dockerclient does not cover or decode. It reuses the transport of an
+// existing client, so unix sockets and TLS work the same way.
+type APIClient struct {
+	client *docker.Client
+}
+
+// Network is a network with the swarm flags that go-dockerclient does not decode.
+type Network struct {
+	docker.Network
+	Attachable bool
+	Ingress    bool
+}
+
+// Info is the information of the daemon with its full swarm state, which
+// go-dockerclient decodes only partially.
+type Info struct {
+	docker.DockerInfo
+	Swarm SwarmInfo
+}
+
+// Container is an inspected container with the IPAM settings of its
+// endpoints, which go-dockerclient does not decode.
+type Container struct {
+	docker.Container
+	// EndpointIPAM holds the IPAM settings of the endpoints of the container, by network name.
+	EndpointIPAM map[string]EndpointIPAM
+}
+
+// EndpointIPAM is the IPAM configuration requested for a container endpoint.
+type EndpointIPAM struct {
+	IPv4Address  string
+	IPv6Address  string
+	LinkLocalIPs []string
+}
+
+func (c *Container) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.Container); err != nil {
+		return err
+	}
+	var settings struct {
+		NetworkSettings *struct {
+			Networks map[string]struct{ IPAMConfig *EndpointIPAM }
+		}
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return err
+	}
+	if settings.NetworkSettings == nil {
+		return nil
+	}
+	c.EndpointIPAM = make(map[string]EndpointIPAM)
+	for name, network := range settings.NetworkSettings.Networks {
+		if network.IPAMConfig != nil {
+			c.EndpointIPAM[name] = *network.IPAMConfig
+		}
+	}
+	return nil
+}
+
+func NewAPIClient(client *docker.Client) *APIClient {
+	return &APIClient{client: client}
+}
+
+func (c *APIClient) Info() (*Info, error) {
+	var info Info
+	if err := c.do(http.MethodGet, "/info", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *APIClient) InspectContainer(id string) (*Container, error) {
+	var container Container
+	if err := c.do(http.MethodGet, "/containers/"+id+"/json", nil, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+func (c *APIClient) ListNetworks() ([]Network, error) {
+	var networks []Network
+	err := c.do(http.MethodGet, "/networks", nil, &networks)
+	return networks, err
+}
+
+func (c *APIClient) baseURL() string {
+	endpoint := c.client.Endpoint()
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		// the client transport dials the socket, the host is never used
+		return "http://unix.sock"
+	case c.client.TLSConfig != nil:
+		return "https://" + strings.TrimPrefix(endpoint, "tcp://")
+	default:
+		return "http://" + strings.TrimPrefix(endpoint, "tcp://")
+	}
+}
+
+func (c *APIClient) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL()+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		message, _ := io.ReadAll(resp.Body)
+		return &docker.Error{Status: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if out == nil {
+		return nil
+	}
+	decoder := json.NewDecoder(resp.Body)
+	// keep numbers intact when round-tripping generic service specs
+	decoder.UseNumber()
+	return decoder.Decode(out)
+}
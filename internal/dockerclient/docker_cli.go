@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -118,20 +119,152 @@ func parseHost(addr string) (string, string, error) {
 	return proto, fmt.Sprintf("%s:%d", host, port), nil
 }
 
-func SplitDockerImage(img string) (string, string, string) {
-	var registry, tag string
-	repository := img
-	if i := strings.Index(img, "/"); i != -1 {
-		if first := img[:i]; strings.ContainsAny(first, ".:") || first == "localhost" {
-			registry = first
-			repository = img[i+1:]
+const defaultDomain = "docker.io"
+
+// referenceRegexp follows the grammar of github.com/distribution/reference,
+// capturing the name, the tag and the digest of a reference.
+var referenceRegexp = func() *regexp.Regexp {
+	const (
+		alnum           = `[a-z0-9]+`
+		separator       = `(?:[._]|__|[-]+)`
+		pathComponent   = alnum + `(?:` + separator + alnum + `)*`
+		domainComponent = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+		domainName      = domainComponent + `(?:\.` + domainComponent + `)*`
+		ipv6            = `\[[a-fA-F0-9:]+\]`
+		domain          = `(?:` + domainName + `|` + ipv6 + `)(?::[0-9]+)?`
+		name            = `(?:` + domain + `/)?` + pathComponent + `(?:/` + pathComponent + `)*`
+		tag             = `[\w][\w.-]{0,127}`
+		digest          = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[[:xdigit:]]{32,}`
+	)
+	return regexp.MustCompile(`^(` + name + `)(?::(` + tag + `))?(?:@(` + digest + `))?$`)
+}()
+
+// ImageReference is a parsed image reference such as
+// "registry:5000/team/app:1.2@sha256:...". Registry and Repository are as
+// written in the reference, see Domain and Path for their normalized form.
+type ImageReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseImageReference parses an image reference following the grammar of the
+// Docker distribution reference.
+func ParseImageReference(s string) (ImageReference, error) {
+	matches := referenceRegexp.FindStringSubmatch(s)
+	if matches == nil {
+		return ImageReference{}, fmt.Errorf("invalid image reference %q", s)
+	}
+	if len(matches[1]) > 255 {
+		return ImageReference{}, fmt.Errorf("invalid image reference %q: name longer than 255 characters", s)
+	}
+
+	ref := ImageReference{Repository: matches[1], Tag: matches[2], Digest: matches[3]}
+	// Like the Docker CLI, the first component is a registry only if it can't
+	// be a repository path component.
+	if i := strings.Index(ref.Repository, "/"); i != -1 {
+		if first := ref.Repository[:i]; strings.ContainsAny(first, ".:") || first == "localhost" || strings.ToLower(first) != first {
+			ref.Registry, ref.Repository = first, ref.Repository[i+1:]
 		}
 	}
+	return ref, nil
+}
 
-	if i := strings.Index(repository, ":"); i != -1 {
-		tag = repository[i+1:]
-		repository = repository[:i]
+// Domain returns the registry of the image, defaulting to docker.io.
+func (r ImageReference) Domain() string {
+	if r.Registry == "" || r.Registry == "index.docker.io" {
+		return defaultDomain
 	}
+	return r.Registry
+}
+
+// Path returns the repository of the image in the registry, such as
+// "library/nginx" for "nginx".
+func (r ImageReference) Path() string {
+	if r.Domain() == defaultDomain && !strings.Contains(r.Repository, "/") {
+		return "library/" + r.Repository
+	}
+	return r.Repository
+}
+
+// FamiliarName returns the shortest name of the image, as shown by the
+// Docker CLI, such as "nginx" for "docker.io/library/nginx".
+func (r ImageReference) FamiliarName() string {
+	if r.Domain() != defaultDomain {
+		return r.Registry + "/" + r.Repository
+	}
+	if path, found := strings.CutPrefix(r.Path(), "library/"); found && !strings.Contains(path, "/") {
+		return path
+	}
+	return r.Path()
+}
+
+// Canonical returns the fully qualified reference, such as
+// "docker.io/library/nginx:1.27@sha256:...".
+func (r ImageReference) Canonical() string {
+	canonical := r.Domain() + "/" + r.Path()
+	if r.Tag != "" {
+		canonical += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		canonical += "@" + r.Digest
+	}
+	return canonical
+}
+
+// ParseSignal parses a signal given by name ("SIGHUP", "HUP", case insensitive)
+// or by number ("1", up to 31), or -1 which stands for a restart.
+func ParseSignal(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		if n != -1 && (n < 1 || n > 31) {
+			return 0, fmt.Errorf("invalid signal number %d", n)
+		}
+		return n, nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if signal, ok := signals[name]; ok {
+		return int(signal), nil
+	}
+	return 0, fmt.Errorf("unknown signal %q", s)
+}
 
-	return registry, repository, tag
+// signals maps signal names to their number inside (Linux) containers.
+var signals = map[string]docker.Signal{
+	"SIGABRT":   docker.SIGABRT,
+	"SIGALRM":   docker.SIGALRM,
+	"SIGBUS":    docker.SIGBUS,
+	"SIGCHLD":   docker.SIGCHLD,
+	"SIGCONT":   docker.SIGCONT,
+	"SIGFPE":    docker.SIGFPE,
+	"SIGHUP":    docker.SIGHUP,
+	"SIGILL":    docker.SIGILL,
+	"SIGINT":    docker.SIGINT,
+	"SIGIO":     docker.SIGIO,
+	"SIGIOT":    docker.SIGIOT,
+	"SIGKILL":   docker.SIGKILL,
+	"SIGPIPE":   docker.SIGPIPE,
+	"SIGPROF":   docker.SIGPROF,
+	"SIGPWR":    docker.SIGPWR,
+	"SIGQUIT":   docker.SIGQUIT,
+	"SIGSEGV":   docker.SIGSEGV,
+	"SIGSTKFLT": docker.SIGSTKFLT,
+	"SIGSTOP":   docker.SIGSTOP,
+	"SIGSYS":    docker.SIGSYS,
+	"SIGTERM":   docker.SIGTERM,
+	"SIGTRAP":   docker.SIGTRAP,
+	"SIGTSTP":   docker.SIGTSTP,
+	"SIGTTIN":   docker.SIGTTIN,
+	"SIGTTOU":   docker.SIGTTOU,
+	"SIGURG":    docker.SIGURG,
+	"SIGUSR1":   docker.SIGUSR1,
+	"SIGUSR2":   docker.SIGUSR2,
+	"SIGVTALRM": docker.SIGVTALRM,
+	"SIGWINCH":  docker.SIGWINCH,
+	"SIGXCPU":   docker.SIGXCPU,
+	"SIGXFSZ":   docker.SIGXFSZ,
 }
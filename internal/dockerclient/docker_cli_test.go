@@ -65,119 +65,6 @@ func TestUnixBadFormat(t *testing.T) {
 	}
 }
 
-type splitDockerImageResults struct {
-	registry   string
-	repository string
-	tag        string
-}
-
-func assertSplitDockerImage(t *testing.T, image string, expected splitDockerImageResults) {
-	registry, repository, tag := SplitDockerImage(image)
-
-	assert.Equal(t, expected.registry, registry)
-	assert.Equal(t, expected.repository, repository)
-	assert.Equal(t, expected.tag, tag)
-
-	dockerImage := context.DockerImage{
-		Registry:   registry,
-		Repository: repository,
-		Tag:        tag,
-	}
-	assert.Equal(t, image, dockerImage.String())
-}
-
-func TestSplitDockerImage(t *testing.T) {
-	t.Run("base image", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "",
-			repository: "ubuntu",
-			tag:        "",
-		}
-		assertSplitDockerImage(t, "ubuntu", expected)
-	})
-
-	t.Run("image with registry", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "custom.registry",
-			repository: "ubuntu",
-			tag:        "",
-		}
-		assertSplitDockerImage(t, "custom.registry/ubuntu", expected)
-	})
-
-	t.Run("image with tag", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "",
-			repository: "ubuntu",
-			tag:        "12.04",
-		}
-		assertSplitDockerImage(t, "ubuntu:12.04", expected)
-	})
-
-	t.Run("image with registry and tag", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "custom.registry",
-			repository: "ubuntu",
-			tag:        "12.04",
-		}
-		assertSplitDockerImage(t, "custom.registry/ubuntu:12.04", expected)
-	})
-
-	t.Run("image with localhost registry and tag", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "localhost",
-			repository: "ubuntu",
-			tag:        "12.04",
-		}
-		assertSplitDockerImage(t, "localhost/ubuntu:12.04", expected)
-	})
-
-	t.Run("image with localhost registry on custom port and tag", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "localhost:8888",
-			repository: "ubuntu",
-			tag:        "12.04",
-		}
-		assertSplitDockerImage(t, "localhost:8888/ubuntu:12.04", expected)
-	})
-
-	t.Run("image with localhost registry on custom port and namespaced repository and tag", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "localhost:8888",
-			repository: "ubuntu/foo",
-			tag:        "12.04",
-		}
-		assertSplitDockerImage(t, "localhost:8888/ubuntu/foo:12.04", expected)
-	})
-
-	t.Run("image with namespaced repository", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "",
-			repository: "tianon/centos",
-			tag:        "",
-		}
-		assertSplitDockerImage(t, "tianon/centos", expected)
-	})
-
-	t.Run("image with namespaced repository and tag", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "",
-			repository: "tianon/centos",
-			tag:        "7",
-		}
-		assertSplitDockerImage(t, "tianon/centos:7", expected)
-	})
-
-	t.Run("image with registry and namespaced repository and tag", func(t *testing.T) {
-		expected := splitDockerImageResults{
-			registry:   "custom.registry",
-			repository: "tianon/centos",
-			tag:        "7",
-		}
-		assertSplitDockerImage(t, "custom.registry/tianon/centos:7", expected)
-	})
-}
-
 func TestParseHostUnix(t *testing.T) {
 	proto, addr, err := parseHost("unix:///var/run/docker.sock")
 	assert.NoError(t, err)
@@ -273,3 +160,184 @@ func TestTlsEnabled(t *testing.T) {
 	tls = tlsEnabled(filepaths["cert"], filepaths["caCert"], filepaths["key"])
 	assert.True(t, tls)
 }
+
+func TestParseSignal(t *testing.T) {
+	for input, expected := range map[string]int{
+		"SIGHUP":  1,
+		"HUP":     1,
+		"sigusr2": 12,
+		"usr1":    10,
+		"1":       1,
+		"-1":      -1,
+		" 15 ":    15,
+		"31":      31,
+	} {
+		signal, err := ParseSignal(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, signal, input)
+	}
+
+	for _, input := range []string{"", "SIGFOO", "HUP1", "0", "-5", "32", "999"} {
+		_, err := ParseSignal(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	const digest = "sha256:0c86dddac19f2ce4fd716ac58c0fd87bf69bfd4edabfd6971fb885bafd12a00b"
+	for _, tc := range []struct {
+		reference    string
+		want         ImageReference
+		domain       string
+		path         string
+		familiarName string
+		canonical    string
+	}{
+		{
+			reference:    "nginx",
+			want:         ImageReference{Repository: "nginx"},
+			domain:       "docker.io",
+			path:         "library/nginx",
+			familiarName: "nginx",
+			canonical:    "docker.io/library/nginx",
+		},
+		{
+			reference:    "docker.io/library/nginx:1.27",
+			want:         ImageReference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.27"},
+			domain:       "docker.io",
+			path:         "library/nginx",
+			familiarName: "nginx",
+			canonical:    "docker.io/library/nginx:1.27",
+		},
+		{
+			reference:    "ubuntu",
+			want:         ImageReference{Repository: "ubuntu"},
+			domain:       "docker.io",
+			path:         "library/ubuntu",
+			familiarName: "ubuntu",
+			canonical:    "docker.io/library/ubuntu",
+		},
+		{
+			reference:    "ubuntu:12.04",
+			want:         ImageReference{Repository: "ubuntu", Tag: "12.04"},
+			domain:       "docker.io",
+			path:         "library/ubuntu",
+			familiarName: "ubuntu",
+			canonical:    "docker.io/library/ubuntu:12.04",
+		},
+		{
+			reference:    "custom.registry/ubuntu",
+			want:         ImageReference{Registry: "custom.registry", Repository: "ubuntu"},
+			domain:       "custom.registry",
+			path:         "ubuntu",
+			familiarName: "custom.registry/ubuntu",
+			canonical:    "custom.registry/ubuntu",
+		},
+		{
+			reference:    "custom.registry/ubuntu:12.04",
+			want:         ImageReference{Registry: "custom.registry", Repository: "ubuntu", Tag: "12.04"},
+			domain:       "custom.registry",
+			path:         "ubuntu",
+			familiarName: "custom.registry/ubuntu",
+			canonical:    "custom.registry/ubuntu:12.04",
+		},
+		{
+			reference:    "localhost/ubuntu:12.04",
+			want:         ImageReference{Registry: "localhost", Repository: "ubuntu", Tag: "12.04"},
+			domain:       "localhost",
+			path:         "ubuntu",
+			familiarName: "localhost/ubuntu",
+			canonical:    "localhost/ubuntu:12.04",
+		},
+		{
+			reference:    "localhost:8888/ubuntu:12.04",
+			want:         ImageReference{Registry: "localhost:8888", Repository: "ubuntu", Tag: "12.04"},
+			domain:       "localhost:8888",
+			path:         "ubuntu",
+			familiarName: "localhost:8888/ubuntu",
+			canonical:    "localhost:8888/ubuntu:12.04",
+		},
+		{
+			reference:    "localhost:8888/ubuntu/foo:12.04",
+			want:         ImageReference{Registry: "localhost:8888", Repository: "ubuntu/foo", Tag: "12.04"},
+			domain:       "localhost:8888",
+			path:         "ubuntu/foo",
+			familiarName: "localhost:8888/ubuntu/foo",
+			canonical:    "localhost:8888/ubuntu/foo:12.04",
+		},
+		{
+			reference:    "tianon/centos",
+			want:         ImageReference{Repository: "tianon/centos"},
+			domain:       "docker.io",
+			path:         "tianon/centos",
+			familiarName: "tianon/centos",
+			canonical:    "docker.io/tianon/centos",
+		},
+		{
+			reference:    "tianon/centos:7",
+			want:         ImageReference{Repository: "tianon/centos", Tag: "7"},
+			domain:       "docker.io",
+			path:         "tianon/centos",
+			familiarName: "tianon/centos",
+			canonical:    "docker.io/tianon/centos:7",
+		},
+		{
+			reference:    "custom.registry/tianon/centos:7",
+			want:         ImageReference{Registry: "custom.registry", Repository: "tianon/centos", Tag: "7"},
+			domain:       "custom.registry",
+			path:         "tianon/centos",
+			familiarName: "custom.registry/tianon/centos",
+			canonical:    "custom.registry/tianon/centos:7",
+		},
+		{
+			reference:    "app:1.2@" + digest,
+			want:         ImageReference{Repository: "app", Tag: "1.2", Digest: digest},
+			domain:       "docker.io",
+			path:         "library/app",
+			familiarName: "app",
+			canonical:    "docker.io/library/app:1.2@" + digest,
+		},
+		{
+			reference:    "registry:5000/team/app@" + digest,
+			want:         ImageReference{Registry: "registry:5000", Repository: "team/app", Digest: digest},
+			domain:       "registry:5000",
+			path:         "team/app",
+			familiarName: "registry:5000/team/app",
+			canonical:    "registry:5000/team/app@" + digest,
+		},
+		{
+			reference:    "localhost/app",
+			want:         ImageReference{Registry: "localhost", Repository: "app"},
+			domain:       "localhost",
+			path:         "app",
+			familiarName: "localhost/app",
+			canonical:    "localhost/app",
+		},
+		{
+			reference:    "[::1]:5000/app:latest",
+			want:         ImageReference{Registry: "[::1]:5000", Repository: "app", Tag: "latest"},
+			domain:       "[::1]:5000",
+			path:         "app",
+			familiarName: "[::1]:5000/app",
+			canonical:    "[::1]:5000/app:latest",
+		},
+	} {
+		t.Run(tc.reference, func(t *testing.T) {
+			ref, err := ParseImageReference(tc.reference)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, ref)
+			assert.Equal(t, tc.domain, ref.Domain())
+			assert.Equal(t, tc.path, ref.Path())
+			assert.Equal(t, tc.familiarName, ref.FamiliarName())
+			assert.Equal(t, tc.canonical, ref.Canonical())
+
+			image := context.DockerImage{Registry: ref.Registry, Repository: ref.Repository, Tag: ref.Tag, Digest: ref.Digest}
+			assert.Equal(t, tc.reference, image.String())
+		})
+	}
+
+	for _, reference := range []string{"", "Nginx", "nginx:", "nginx@sha256:abc", "-app", "team//app", ":1.2"} {
+		_, err := ParseImageReference(reference)
+		assert.Error(t, err, reference)
+	}
+}
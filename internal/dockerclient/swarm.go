@@ -0,0 +1,110 @@
+package dockerclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type SwarmVersion struct {
+	Index uint64
+}
+
+type SwarmConfig struct {
+	ID        string
+	Version   SwarmVersion
+	CreatedAt time.Time
+	Spec      SwarmConfigSpec
+}
+
+type SwarmConfigSpec struct {
+	Name   string
+	Labels map[string]string `json:",omitempty"`
+	Data   []byte            `json:",omitempty"`
+}
+
+// SwarmService holds a service with its spec left as generic JSON, so that
+// fields unknown to docker-gen survive an update untouched.
+type SwarmService struct {
+	ID      string
+	Version SwarmVersion
+	Spec    map[string]any
+}
+
+type SwarmInfo struct {
+	NodeID           string
+	NodeAddr         string
+	LocalNodeState   string
+	ControlAvailable bool
+	Cluster          *struct{ ID string }
+}
+
+type SwarmNode struct {
+	ID            string
+	ManagerStatus *SwarmManagerStatus
+}
+
+type SwarmManagerStatus struct {
+	Leader       bool
+	Reachability string
+	Addr         string
+}
+
+func (c *APIClient) ListConfigs(filters map[string][]string) ([]SwarmConfig, error) {
+	path := "/configs"
+	if len(filters) > 0 {
+		encoded, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		path += "?filters=" + url.QueryEscape(string(encoded))
+	}
+	var configs []SwarmConfig
+	err := c.do(http.MethodGet, path, nil, &configs)
+	return configs, err
+}
+
+func (c *APIClient) InspectConfig(id string) (*SwarmConfig, error) {
+	var config SwarmConfig
+	if err := c.do(http.MethodGet, "/configs/"+id, nil, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// CreateConfig creates a config object and returns its ID.
+func (c *APIClient) CreateConfig(spec SwarmConfigSpec) (string, error) {
+	var created struct{ ID string }
+	err := c.do(http.MethodPost, "/configs/create", spec, &created)
+	return created.ID, err
+}
+
+func (c *APIClient) RemoveConfig(id string) error {
+	return c.do(http.MethodDelete, "/configs/"+id, nil, nil)
+}
+
+// InspectNode inspects a node of the swarm, which only works on managers.
+func (c *APIClient) InspectNode(id string) (*SwarmNode, error) {
+	var node SwarmNode
+	if err := c.do(http.MethodGet, "/nodes/"+id, nil, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+func (c *APIClient) InspectService(id string) (*SwarmService, error) {
+	var service SwarmService
+	if err := c.do(http.MethodGet, "/services/"+id, nil, &service); err != nil {
+		return nil, err
+	}
+	return &service, nil
+}
+
+// UpdateService replaces the spec of a service. version must be the version
+// index the spec was read at.
+func (c *APIClient) UpdateService(id string, version uint64, spec map[string]any) error {
+	path := fmt.Sprintf("/services/%s/update?version=%d", id, version)
+	return c.do(http.MethodPost, path, spec, nil)
+}
@@ -0,0 +1,393 @@
+package generator
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/nginx-proxy/docker-gen/internal/config"
+	"github.com/nginx-proxy/docker-gen/internal/dockerclient"
+)
+
+const (
+	// swarmConfigLabel marks the config objects created by docker-gen, its value is the config base name.
+	swarmConfigLabel = "com.github.nginx-proxy.docker-gen.config"
+
+	// versionHashLength is the number of hex digits of the content hash in swarm config version names.
+	versionHashLength = 12
+)
+
+// destination is where rendered template contents are written to.
+type destination interface {
+	// Read returns the current contents of the destination, or nil if it does not exist yet.
+	Read() ([]byte, error)
+	Write(contents []byte) error
+	String() string
+}
+
+// newDestination returns the destination for dest, or nil if dest is empty
+// and contents go to stdout.
+func (g *generator) newDestination(dest string) (destination, error) {
+	switch {
+	case dest == "":
+		return nil, nil
+	case strings.HasPrefix(dest, config.ContainerDestScheme):
+		return newContainerDestination(g.Client, dest)
+	case strings.HasPrefix(dest, config.SwarmConfigDestScheme):
+		return newSwarmConfigDestination(dockerclient.NewAPIClient(g.Client), dest)
+	}
+	return fileDestination(dest), nil
+}
+
+// fileDestination is a path on the local filesystem.
+type fileDestination string
+
+func (d fileDestination) Read() ([]byte, error) {
+	contents, err := os.ReadFile(string(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return contents, err
+}
+
+func (d fileDestination) Write(contents []byte) error {
+	return os.WriteFile(string(d), contents, 0644)
+}
+
+func (d fileDestination) String() string {
+	return string(d)
+}
+
+// containerDestination is a file inside a running container, written through
+// the Docker archive API. It is addressed as container://<name or ID>:<path>.
+type containerDestination struct {
+	client    *docker.Client
+	container string
+	path      string
+
+	// header is the archive header of the existing file, set by Read, whose mode
+	// and owner are kept when the file is replaced.
+	header *tar.Header
+	read   bool
+}
+
+func newContainerDestination(client *docker.Client, dest string) (*containerDestination, error) {
+	parsed, err := config.ParseContainerDest(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &containerDestination{
+		client:    client,
+		container: parsed.Container,
+		path:      parsed.Path,
+	}, nil
+}
+
+func (d *containerDestination) Read() ([]byte, error) {
+	d.read, d.header = true, nil
+	buf := new(bytes.Buffer)
+	err := d.client.DownloadFromContainer(d.container, docker.DownloadFromContainerOptions{
+		OutputStream: buf,
+		Path:         d.path,
+	})
+	var apiErr *docker.Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in archive", d.path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && header.Name == path.Base(d.path) {
+			d.header = header
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+func (d *containerDestination) Write(contents []byte) error {
+	if !d.read {
+		// look up the mode and owner of the file being replaced
+		if _, err := d.Read(); err != nil {
+			return err
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	header := &tar.Header{
+		Name:    path.Base(d.path),
+		Mode:    0644,
+		Size:    int64(len(contents)),
+		ModTime: time.Now(),
+	}
+	if d.header != nil {
+		header.Mode = d.header.Mode
+		header.Uid, header.Gid = d.header.Uid, d.header.Gid
+		header.Uname, header.Gname = d.header.Uname, d.header.Gname
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(contents); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return d.client.UploadToContainer(d.container, docker.UploadToContainerOptions{
+		InputStream: buf,
+		Path:        path.Dir(d.path),
+	})
+}
+
+func (d *containerDestination) String() string {
+	return config.ContainerDestScheme + d.container + ":" + d.path
+}
+
+// swarmConfigDestination publishes rendered contents as versioned Swarm config
+// objects named <name>-<content hash>, optionally rolling a service onto the
+// newest version. It is addressed as
+// swarm-config://<name>[?service=<service>&target=<path>&keep=<count>].
+type swarmConfigDestination struct {
+	client  *dockerclient.APIClient
+	name    string
+	service string
+	target  string
+	keep    int
+}
+
+func newSwarmConfigDestination(client *dockerclient.APIClient, dest string) (*swarmConfigDestination, error) {
+	parsed, err := config.ParseSwarmConfigDest(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &swarmConfigDestination{
+		client:  client,
+		name:    parsed.Name,
+		service: parsed.Service,
+		target:  parsed.Target,
+		keep:    parsed.Keep,
+	}, nil
+}
+
+// versions returns the config objects created for this destination, newest first.
+func (d *swarmConfigDestination) versions() ([]dockerclient.SwarmConfig, error) {
+	configs, err := d.client.ListConfigs(map[string][]string{
+		"label": {swarmConfigLabel + "=" + d.name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(configs, func(i, j int) bool {
+		return configs[i].CreatedAt.After(configs[j].CreatedAt)
+	})
+	return configs, nil
+}
+
+// current returns the ID of the version in use: the one mounted by the
+// service if there is one, otherwise the newest version.
+func (d *swarmConfigDestination) current() (string, error) {
+	if d.service != "" {
+		service, err := d.client.InspectService(d.service)
+		if err != nil {
+			return "", err
+		}
+		for _, ref := range serviceConfigReferences(service.Spec) {
+			if r, ok := ref.(map[string]any); ok && d.isVersionReference(r) {
+				id, _ := r["ConfigID"].(string)
+				return id, nil
+			}
+		}
+		return "", nil
+	}
+
+	versions, err := d.versions()
+	if err != nil || len(versions) == 0 {
+		return "", err
+	}
+	return versions[0].ID, nil
+}
+
+func (d *swarmConfigDestination) Read() ([]byte, error) {
+	id, err := d.current()
+	if err != nil || id == "" {
+		return nil, err
+	}
+	config, err := d.client.InspectConfig(id)
+	if err != nil {
+		return nil, err
+	}
+	return config.Spec.Data, nil
+}
+
+func (d *swarmConfigDestination) Write(contents []byte) error {
+	sum := sha256.Sum256(contents)
+	name := d.name + "-" + hex.EncodeToString(sum[:])[:versionHashLength]
+
+	versions, err := d.versions()
+	if err != nil {
+		return err
+	}
+
+	// Config objects are immutable, so going back to earlier contents reuses the
+	// existing version. Without a service to point at it, the version is recreated
+	// instead so that it becomes the newest one.
+	var id string
+	for _, version := range versions {
+		if version.Spec.Name != name {
+			continue
+		}
+		if d.service != "" {
+			id = version.ID
+		} else if err := d.client.RemoveConfig(version.ID); err != nil {
+			return fmt.Errorf("unable to recreate config %s: %w", name, err)
+		}
+	}
+	if id == "" {
+		id, err = d.client.CreateConfig(dockerclient.SwarmConfigSpec{
+			Name:   name,
+			Labels: map[string]string{swarmConfigLabel: d.name},
+			Data:   contents,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to create config %s: %w", name, err)
+		}
+		log.Printf("Created swarm config %s", name)
+	}
+
+	if d.service != "" {
+		if err := d.updateService(id, name); err != nil {
+			return fmt.Errorf("unable to update service %s: %w", d.service, err)
+		}
+		log.Printf("Updated service %s to use swarm config %s", d.service, name)
+	}
+
+	d.prune(id)
+	return nil
+}
+
+// updateService points the service at the config version id, replacing any
+// earlier version of this destination or any config mounted at the target.
+func (d *swarmConfigDestination) updateService(id, name string) error {
+	service, err := d.client.InspectService(d.service)
+	if err != nil {
+		return err
+	}
+
+	references := []any{}
+	for _, ref := range serviceConfigReferences(service.Spec) {
+		if r, ok := ref.(map[string]any); ok {
+			file, _ := r["File"].(map[string]any)
+			fileName, _ := file["Name"].(string)
+			if d.isVersionReference(r) || fileName == d.target {
+				continue
+			}
+		}
+		references = append(references, ref)
+	}
+	references = append(references, map[string]any{
+		"ConfigID":   id,
+		"ConfigName": name,
+		"File": map[string]any{
+			"Name": d.target,
+			"UID":  "0",
+			"GID":  "0",
+			"Mode": 0444,
+		},
+	})
+	serviceContainerSpec(service.Spec)["Configs"] = references
+
+	return d.client.UpdateService(service.ID, service.Version.Index, service.Spec)
+}
+
+// isVersionReference reports whether a service config reference points at a version of this destination.
+func (d *swarmConfigDestination) isVersionReference(ref map[string]any) bool {
+	name, _ := ref["ConfigName"].(string)
+	hash, found := strings.CutPrefix(name, d.name+"-")
+	if !found || len(hash) != versionHashLength {
+		return false
+	}
+	return strings.Trim(hash, "0123456789abcdef") == ""
+}
+
+// serviceTaskTemplate returns TaskTemplate of a generic service spec, creating
+// it if needed.
+func serviceTaskTemplate(spec map[string]any) map[string]any {
+	taskTemplate, _ := spec["TaskTemplate"].(map[string]any)
+	if taskTemplate == nil {
+		taskTemplate = map[string]any{}
+		spec["TaskTemplate"] = taskTemplate
+	}
+	return taskTemplate
+}
+
+// serviceContainerSpec returns TaskTemplate.ContainerSpec of a generic service
+// spec, creating the intermediate objects if needed.
+func serviceContainerSpec(spec map[string]any) map[string]any {
+	taskTemplate := serviceTaskTemplate(spec)
+	containerSpec, _ := taskTemplate["ContainerSpec"].(map[string]any)
+	if containerSpec == nil {
+		containerSpec = map[string]any{}
+		taskTemplate["ContainerSpec"] = containerSpec
+	}
+	return containerSpec
+}
+
+func serviceConfigReferences(spec map[string]any) []any {
+	references, _ := serviceContainerSpec(spec)["Configs"].([]any)
+	return references
+}
+
+// prune removes all but the newest keep versions, never removing current.
+// Versions still in use by running tasks cannot be removed yet; they are
+// retried on the next write.
+func (d *swarmConfigDestination) prune(current string) {
+	versions, err := d.versions()
+	if err != nil {
+		log.Printf("Unable to list swarm configs for %s: %s", d, err)
+		return
+	}
+	kept := 1
+	for _, version := range versions {
+		if version.ID == current {
+			continue
+		}
+		if kept < d.keep {
+			kept++
+			continue
+		}
+		if err := d.client.RemoveConfig(version.ID); err != nil {
+			log.Printf("Unable to remove swarm config %s: %s", version.Spec.Name, err)
+			continue
+		}
+		log.Printf("Removed swarm config %s", version.Spec.Name)
+	}
+}
+
+func (d *swarmConfigDestination) String() string {
+	return config.SwarmConfigDestScheme + d.name
+}
@@ -0,0 +1,152 @@
+package generator
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nginx-proxy/docker-gen/internal/config"
+)
+
+// maxDiffCells bounds the size of the table used to diff drifted contents.
+const maxDiffCells = 1 << 20
+
+// watchDestinations periodically compares the destination of each config that
+// has drift_check set with the contents docker-gen last rendered to it, and
+// restores or reports changes made outside of docker-gen.
+func (g *generator) watchDestinations() {
+	for _, cfg := range g.Configs.Config {
+		if cfg.DriftCheck <= 0 || cfg.Dest == "" {
+			continue
+		}
+
+		log.Printf("Checking %s for drift every %s", cfg.Dest, cfg.DriftCheck)
+		g.wg.Add(1)
+		ticker := time.NewTicker(cfg.DriftCheck)
+		go func(cfg config.Config) {
+			defer g.wg.Done()
+
+			sigChan, cleanup := newSignalChannel()
+			defer cleanup()
+			for {
+				select {
+				case <-ticker.C:
+					if restored := g.checkDrift(cfg); restored != nil {
+						g.notify(cfg, renderResult{changed: true, contents: restored}, nil)
+					}
+				case sig := <-sigChan:
+					switch sig {
+					case syscall.SIGTERM, syscall.SIGINT:
+						ticker.Stop()
+						return
+					}
+				}
+			}
+		}(cfg)
+	}
+}
+
+// checkDrift compares the destination of cfg with the last rendered contents
+// and returns the restored contents, or nil if nothing was restored.
+func (g *generator) checkDrift(cfg config.Config) []byte {
+	dest, err := g.newDestination(cfg.Dest)
+	if err != nil || dest == nil {
+		return nil
+	}
+
+	state := g.state(cfg)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.rendered == nil {
+		// nothing rendered yet, so nothing to drift from
+		return nil
+	}
+	current, err := dest.Read()
+	if err != nil {
+		log.Printf("Unable to check %s for drift: %s", dest, err)
+		return nil
+	}
+	if current != nil && bytes.Equal(current, state.rendered) {
+		return nil
+	}
+
+	log.Printf("Contents of %s changed outside of docker-gen:\n%s", dest, diffLines(string(state.rendered), string(current)))
+	if cfg.DriftAction == config.DriftActionReport {
+		return nil
+	}
+	if err := dest.Write(state.rendered); err != nil {
+		log.Printf("Unable to restore %s: %s", dest, err)
+		return nil
+	}
+	log.Printf("Restored '%s' to the last generated contents", dest)
+	return state.rendered
+}
+
+// diffLines returns the lines removed from a (prefixed with "-") and added in
+// b (prefixed with "+"), in order. Lines common to both are omitted.
+func diffLines(a, b string) string {
+	x := strings.SplitAfter(a, "\n")
+	y := strings.SplitAfter(b, "\n")
+
+	// Strip the common prefix and suffix, drift is usually a small local edit.
+	for len(x) > 0 && len(y) > 0 && x[0] == y[0] {
+		x, y = x[1:], y[1:]
+	}
+	for len(x) > 0 && len(y) > 0 && x[len(x)-1] == y[len(y)-1] {
+		x, y = x[:len(x)-1], y[:len(y)-1]
+	}
+
+	var out strings.Builder
+	line := func(prefix, s string) {
+		if s == "" {
+			return
+		}
+		out.WriteString(prefix)
+		out.WriteString(strings.TrimSuffix(s, "\n"))
+		out.WriteString("\n")
+	}
+
+	if len(x)*len(y) > maxDiffCells {
+		for _, s := range x {
+			line("-", s)
+		}
+		for _, s := range y {
+			line("+", s)
+		}
+		return out.String()
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i++
+			j++
+		case j == len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+			line("-", x[i])
+			i++
+		default:
+			line("+", y[j])
+			j++
+		}
+	}
+	return out.String()
+}
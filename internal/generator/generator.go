@@ -1,11 +1,15 @@
 package generator
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -32,6 +36,79 @@ type generator struct {
 	wg                    sync.WaitGroup
 	retry                 bool
 	getCurrentContainerID func(...string) string
+
+	statesMu sync.Mutex
+	states   map[string]*configState
+
+	imagesMu sync.Mutex
+	images   map[string]*docker.Image
+	// imageUsers holds the IDs of the images of the containers last listed
+	// for each config, keyed by stateKey.
+	imageUsers map[string]map[string]bool
+
+	infoMu      sync.Mutex
+	infoExpires time.Time
+}
+
+// configState is what the generator remembers about a config between renders.
+// Its lock is held while the config destination is written.
+type configState struct {
+	mu sync.Mutex
+	// rendered holds the contents last rendered to the destination.
+	rendered []byte
+	// containers holds the containers of the last render.
+	containers context.Context
+	// bad is set when rendered contents were rolled back after failing to notify.
+	bad *badRender
+	// lastNotified is when the notification pipeline last started.
+	lastNotified time.Time
+	// pending is the notification delayed by notify_min_interval, if any.
+	pending *renderResult
+}
+
+// badRender identifies contents that were rolled back, so that they are not
+// written again until the containers they were rendered from change.
+type badRender struct {
+	hash       [sha256.Size]byte
+	containers context.Context
+}
+
+func (b *badRender) matches(contents []byte, containers context.Context) bool {
+	return sha256.Sum256(contents) == b.hash && context.DiffContainers(b.containers, containers).Empty()
+}
+
+// renderResult describes a render of a config to its notification steps.
+type renderResult struct {
+	changed  bool
+	contents []byte
+	changes  context.Changes
+	// previous holds the contents replaced by this render, if any.
+	previous []byte
+	// backup is the path of a file holding the previous contents.
+	backup string
+	// notify lists the notifications requested by the template.
+	notify []template.ContainerNotification
+	// skipNotify is set when the template requested no notification.
+	skipNotify bool
+}
+
+// state returns the state of cfg, creating it on first use.
+func (g *generator) state(cfg config.Config) *configState {
+	g.statesMu.Lock()
+	defer g.statesMu.Unlock()
+
+	key := stateKey(cfg)
+	if g.states == nil {
+		g.states = make(map[string]*configState)
+	}
+	if g.states[key] == nil {
+		g.states[key] = &configState{}
+	}
+	return g.states[key]
+}
+
+func stateKey(cfg config.Config) string {
+	return cfg.Template + "\x00" + cfg.Dest
 }
 
 type GeneratorConfig struct {
@@ -50,6 +127,13 @@ type GeneratorConfig struct {
 }
 
 func NewGenerator(gc GeneratorConfig) (*generator, error) {
+	for i := range gc.ConfigFile.Config {
+		cfg := &gc.ConfigFile.Config[i]
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config for %s: %s", cfg.Template, err)
+		}
+	}
+
 	endpoint, err := dockerclient.GetEndpoint(gc.Endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("bad endpoint: %s", err)
@@ -87,6 +171,7 @@ func (g *generator) Generate() error {
 	g.generateAtInterval()
 	g.generateFromEvents()
 	g.generateFromSignals()
+	g.watchDestinations()
 	g.wg.Wait()
 
 	return nil
@@ -126,22 +211,31 @@ func (g *generator) generateFromSignals() {
 	}()
 }
 
+// generateFromContainers generates every config, then notifies the changed
+// ones once all files are written, delivering each container notification
+// shared by several configs only once.
 func (g *generator) generateFromContainers() {
+	var changed []config.Config
+	var results []renderResult
 	for _, config := range g.Configs.Config {
 		containers, err := g.getContainers(config)
 		if err != nil {
 			log.Printf("Error listing containers: %s\n", err)
-			return
+			break
 		}
 
-		changed := template.GenerateFile(config, containers)
-		if !changed {
+		result := g.generateFile(config, containers)
+		if !result.changed {
 			log.Printf("Contents of %s did not change. Skipping notification '%s'", config.Dest, config.NotifyCmd)
 			continue
 		}
-		g.runNotifyCmd(config)
-		g.sendSignalToContainers(config)
-		g.sendSignalToFilteredContainers(config)
+		changed = append(changed, config)
+		results = append(results, result)
+	}
+
+	sent := make(notifications)
+	for i, config := range changed {
+		g.notify(config, results[i], sent)
 	}
 }
 
@@ -168,11 +262,9 @@ func (g *generator) generateAtInterval() {
 						log.Printf("Error listing containers: %s\n", err)
 						continue
 					}
-					// ignore changed return value. always run notify command
-					template.GenerateFile(cfg, containers)
-					g.runNotifyCmd(cfg)
-					g.sendSignalToContainers(cfg)
-					g.sendSignalToFilteredContainers(cfg)
+					// ignore changed result. always run notify command
+					result := g.generateFile(cfg, containers)
+					g.notify(cfg, result, nil)
 				case sig := <-sigChan:
 					log.Printf("Received signal: %s\n", sig)
 					switch sig {
@@ -214,14 +306,12 @@ func (g *generator) generateFromEvents() {
 					log.Printf("Error listing containers: %s\n", err)
 					continue
 				}
-				changed := template.GenerateFile(cfg, containers)
-				if !changed {
+				result := g.generateFile(cfg, containers)
+				if !result.changed {
 					log.Printf("Contents of %s did not change. Skipping notification '%s'", cfg.Dest, cfg.NotifyCmd)
 					continue
 				}
-				g.runNotifyCmd(cfg)
-				g.sendSignalToContainers(cfg)
-				g.sendSignalToFilteredContainers(cfg)
+				g.notify(cfg, result, nil)
 			}
 		}(cfg)
 	}
@@ -233,6 +323,9 @@ func (g *generator) generateFromEvents() {
 		sigChan, cleanup := newSignalChannel()
 		defer cleanup()
 
+		// disconnected is set from losing the connection to the docker daemon
+		// until watching its events again
+		disconnected := false
 		for {
 			watching := false
 
@@ -269,6 +362,10 @@ func (g *generator) generateFromEvents() {
 					}
 					watching = true
 					log.Println("Watching docker events")
+					if disconnected {
+						disconnected = false
+						g.runDockerHook(hookOnDockerReconnect, nil)
+					}
 					// sync all configs after resuming listener
 					g.generateFromContainers()
 				}
@@ -276,6 +373,10 @@ func (g *generator) generateFromEvents() {
 				case event, ok := <-eventChan:
 					if !ok {
 						log.Printf("Docker daemon connection interrupted")
+						if !disconnected {
+							disconnected = true
+							g.runDockerHook(hookOnDockerDisconnect, errors.New("docker daemon connection interrupted"))
+						}
 						if watching {
 							client.RemoveEventListener(eventChan)
 							watching = false
@@ -304,6 +405,10 @@ func (g *generator) generateFromEvents() {
 					err := client.Ping()
 					if err != nil {
 						log.Printf("Unable to ping docker daemon: %s", err)
+						if !disconnected {
+							disconnected = true
+							g.runDockerHook(hookOnDockerDisconnect, err)
+						}
 						if watching {
 							client.RemoveEventListener(eventChan)
 							watching = false
@@ -326,71 +431,112 @@ func (g *generator) generateFromEvents() {
 	}()
 }
 
-func (g *generator) runNotifyCmd(config config.Config) {
-	if config.NotifyCmd == "" {
-		return
+// generateFile renders the config template to its destination. The result
+// reports whether the destination contents changed.
+func (g *generator) generateFile(cfg config.Config, containers context.Context) renderResult {
+	dest, err := g.newDestination(cfg.Dest)
+	if err != nil {
+		log.Printf("Error generating %s: %s\n", cfg.Dest, err)
+		return renderResult{}
 	}
 
-	log.Printf("Running '%s'", config.NotifyCmd)
-	cmd := exec.Command("/bin/sh", "-c", config.NotifyCmd)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error running notify command: %s, %s\n", config.NotifyCmd, err)
+	if err := g.runHook(cfg, hookPreRender, cfg.PreRender, nil); err != nil {
+		log.Printf("Skipping generation of %s: %s hook failed", cfg.DisplayName(), hookPreRender)
+		return renderResult{}
 	}
-	if config.NotifyOutput {
-		for _, line := range strings.Split(string(out), "\n") {
-			if line != "" {
-				log.Printf("[%s]: %s", config.NotifyCmd, line)
-			}
-		}
+
+	// Hooks run without holding the state of the config, which the drift
+	// watcher and notification rollbacks also lock.
+	result, unchanged := g.writeDestination(cfg, dest, containers)
+	if unchanged {
+		g.runHook(cfg, hookOnNoChange, cfg.OnNoChange, nil)
 	}
+	return result
 }
 
-func (g *generator) sendSignalToContainer(container string, signal int) {
-	log.Printf("Sending container '%s' signal '%v'", container, signal)
-
-	if signal == -1 {
-		if err := g.Client.RestartContainer(container, 10); err != nil {
-			log.Printf("Error sending restarting container: %s", err)
-		}
-		return
-	}
+// writeDestination renders the config template and writes it to dest unless
+// its contents are already current, which is reported by unchanged.
+func (g *generator) writeDestination(cfg config.Config, dest destination, containers context.Context) (result renderResult, unchanged bool) {
+	state := g.state(cfg)
+	state.mu.Lock()
+	defer state.mu.Unlock()
 
-	killOpts := docker.KillContainerOptions{
-		ID:     container,
-		Signal: docker.Signal(signal),
+	changes := context.DiffContainers(state.containers, containers)
+	output, err := template.Render(cfg, containers, context.RenderData{Changes: changes})
+	if err != nil {
+		g.runHook(cfg, hookOnRenderError, cfg.OnRenderError, err)
+		log.Fatalf("Unable to generate %s: %s\n", cfg.DisplayName(), err)
 	}
-	if err := g.Client.KillContainer(killOpts); err != nil {
-		log.Printf("Error sending signal to container: %s", err)
+	result = renderResult{
+		contents:   output.Contents,
+		changes:    changes,
+		notify:     output.Notify,
+		skipNotify: output.SkipNotify,
 	}
-}
 
-func (g *generator) sendSignalToContainers(config config.Config) {
-	if len(config.NotifyContainers) < 1 {
-		return
+	// The containers are only remembered once their changes reached the
+	// destination, so that a skipped or failed write reports them again.
+	if dest == nil {
+		os.Stdout.Write(result.contents)
+		state.containers = containers
+		result.changed = true
+		return result, false
 	}
 
-	for container, signal := range config.NotifyContainers {
-		g.sendSignalToContainer(container, signal)
+	if state.bad != nil {
+		if state.bad.matches(result.contents, containers) {
+			log.Printf("Not writing %s: the same contents were rolled back after a notification failure and the containers did not change", dest)
+			return result, false
+		}
+		state.bad = nil
 	}
-}
 
-func (g *generator) sendSignalToFilteredContainers(config config.Config) {
-	if len(config.NotifyContainersFilter) < 1 {
-		return
+	// A local file that cannot be read or written is a configuration error,
+	// other destinations may only be temporarily unavailable.
+	fail := log.Printf
+	if _, local := dest.(fileDestination); local {
+		fail = log.Fatalf
 	}
 
-	containers, err := g.Client.ListContainers(docker.ListContainersOptions{
-		Filters: config.NotifyContainersFilter,
-	})
+	oldContents, err := dest.Read()
 	if err != nil {
-		log.Printf("Error getting containers: %s", err)
-		return
+		fail("Unable to compare current contents of %s: %s\n", dest, err)
+		return result, false
+	}
+	if oldContents != nil && bytes.Equal(oldContents, result.contents) {
+		state.rendered = result.contents
+		state.containers = containers
+		return result, true
+	}
+	if err := dest.Write(result.contents); err != nil {
+		fail("Unable to write to %s: %s\n", dest, err)
+		return result, false
+	}
+	if oldContents != nil {
+		result.previous = oldContents
+		if result.backup, err = writeBackup(cfg, oldContents); err != nil {
+			log.Printf("Unable to back up previous contents of %s: %s\n", dest, err)
+		}
 	}
+	state.rendered = result.contents
+	state.containers = containers
+	result.changed = true
+	log.Printf("Generated '%s' from %d containers", dest, len(containers))
+	return result, false
+}
 
-	for _, container := range containers {
-		g.sendSignalToContainer(container.ID, config.NotifyContainersSignal)
-	}
+// writeBackup saves the contents replaced in the destination of cfg to a file
+// in the temporary directory, one per config, and returns its path.
+func writeBackup(cfg config.Config, contents []byte) (string, error) {
+	return writeStateFile(cfg, ".bak", contents)
+}
+
+// writeStateFile writes contents to the file of cfg with the given suffix in
+// the temporary directory and returns its path.
+func writeStateFile(cfg config.Config, suffix string, contents []byte) (string, error) {
+	sum := sha256.Sum256([]byte(stateKey(cfg)))
+	path := filepath.Join(os.TempDir(), "docker-gen-"+hex.EncodeToString(sum[:])[:12]+suffix)
+	return path, os.WriteFile(path, contents, 0600)
 }
 
 // sortNetworks sorts networks in place by Name (ascending).
@@ -400,13 +546,24 @@ func sortNetworks(networks []context.Network) {
 	})
 }
 
-func (g *generator) getContainers(config config.Config) ([]*context.RuntimeContainer, error) {
-	apiInfo, err := g.Client.Info()
-	if err != nil {
-		log.Printf("Error retrieving docker server info: %s\n", err)
-	} else {
-		context.SetServerInfo(apiInfo)
+func newIPAM(ipam docker.IPAMOptions) context.IPAM {
+	result := context.IPAM{
+		Driver:  ipam.Driver,
+		Options: ipam.Options,
+	}
+	for _, v := range ipam.Config {
+		result.Config = append(result.Config, context.IPAMConfig{
+			Subnet:       v.Subnet,
+			IPRange:      v.IPRange,
+			Gateway:      v.Gateway,
+			AuxAddresses: v.AuxAddress,
+		})
 	}
+	return result
+}
+
+func (g *generator) getContainers(config config.Config) ([]*context.RuntimeContainer, error) {
+	g.refreshServerInfo()
 
 	if g.getCurrentContainerID != nil {
 		id := g.getCurrentContainerID()
@@ -422,13 +579,45 @@ func (g *generator) getContainers(config config.Config) ([]*context.RuntimeConta
 		return nil, err
 	}
 
-	apiNetworks, err := g.Client.ListNetworks()
+	apiNetworks, err := dockerclient.NewAPIClient(g.Client).ListNetworks()
 	if err != nil {
 		return nil, err
 	}
-	networks := make(map[string]docker.Network)
+	networks := make(map[string]dockerclient.Network)
+	dockerNetworks := make([]context.DockerNetwork, 0, len(apiNetworks))
 	for _, apiNetwork := range apiNetworks {
 		networks[apiNetwork.Name] = apiNetwork
+		dockerNetworks = append(dockerNetworks, context.DockerNetwork{
+			ID:         apiNetwork.ID,
+			Name:       apiNetwork.Name,
+			Driver:     apiNetwork.Driver,
+			Scope:      apiNetwork.Scope,
+			Internal:   apiNetwork.Internal,
+			EnableIPv6: apiNetwork.EnableIPv6,
+			Attachable: apiNetwork.Attachable,
+			Ingress:    apiNetwork.Ingress,
+			IPAM:       newIPAM(apiNetwork.IPAM),
+			Labels:     apiNetwork.Labels,
+			Options:    apiNetwork.Options,
+		})
+	}
+	context.SetNetworks(dockerNetworks)
+
+	apiVolumes, err := g.Client.ListVolumes(docker.ListVolumesOptions{})
+	if err != nil {
+		log.Printf("Error listing volumes: %s\n", err)
+	} else {
+		dockerVolumes := make([]context.DockerVolume, 0, len(apiVolumes))
+		for _, apiVolume := range apiVolumes {
+			dockerVolumes = append(dockerVolumes, context.DockerVolume{
+				Name:       apiVolume.Name,
+				Driver:     apiVolume.Driver,
+				Mountpoint: apiVolume.Mountpoint,
+				Labels:     apiVolume.Labels,
+				Options:    apiVolume.Options,
+			})
+		}
+		context.SetVolumes(dockerVolumes)
 	}
 
 	containers := []*context.RuntimeContainer{}
@@ -441,11 +630,19 @@ func (g *generator) getContainers(config config.Config) ([]*context.RuntimeConta
 		containers = append(containers, runtimeContainer)
 	}
 
-	context.SetCurrentContainer(g.currentContainer(containers, networks))
+	// the current container may not be listed, its image is in use all the same
+	current := g.currentContainer(containers, networks)
+	users := containers
+	if current != nil {
+		users = append(users[:len(users):len(users)], current)
+	}
+	g.evictImages(stateKey(config), users)
+
+	context.SetCurrentContainer(current)
 	return containers, nil
 }
 
-func (g *generator) currentContainer(containers []*context.RuntimeContainer, networks map[string]docker.Network) *context.RuntimeContainer {
+func (g *generator) currentContainer(containers []*context.RuntimeContainer, networks map[string]dockerclient.Network) *context.RuntimeContainer {
 	if g.getCurrentContainerID == nil {
 		return nil
 	}
@@ -467,12 +664,12 @@ func (g *generator) currentContainer(containers []*context.RuntimeContainer, net
 	return runtimeContainer
 }
 
-func (g *generator) inspectContainer(id string, networks map[string]docker.Network) (*context.RuntimeContainer, error) {
-	opts := docker.InspectContainerOptions{ID: id}
-	container, err := g.Client.InspectContainerWithOptions(opts)
+func (g *generator) inspectContainer(id string, networks map[string]dockerclient.Network) (*context.RuntimeContainer, error) {
+	inspected, err := dockerclient.NewAPIClient(g.Client).InspectContainer(id)
 	if err != nil {
 		return nil, err
 	}
+	container := &inspected.Container
 
 	// Inspect may return nil pointers for these structs; copy into zero values to avoid a panic.
 	var containerConfig docker.Config
@@ -488,19 +685,25 @@ func (g *generator) inspectContainer(id string, networks map[string]docker.Netwo
 		containerHostConfig = *container.HostConfig
 	}
 
-	registry, repository, tag := dockerclient.SplitDockerImage(containerConfig.Image)
 	runtimeContainer := &context.RuntimeContainer{
 		ID:      container.ID,
 		Created: container.Created,
-		Image: context.DockerImage{
-			Registry:   registry,
-			Repository: repository,
-			Tag:        tag,
-		},
+		Image:   parseImage(containerConfig.Image),
 		State: context.State{
-			Running: container.State.Running,
+			Status:     container.State.Status,
+			Running:    container.State.Running,
+			Paused:     container.State.Paused,
+			Restarting: container.State.Restarting,
+			OOMKilled:  container.State.OOMKilled,
+			Dead:       container.State.Dead,
+			Pid:        container.State.Pid,
+			ExitCode:   container.State.ExitCode,
+			Error:      container.State.Error,
+			StartedAt:  container.State.StartedAt,
+			FinishedAt: container.State.FinishedAt,
 			Health: context.Health{
-				Status: container.State.Health.Status,
+				Status:        container.State.Health.Status,
+				FailingStreak: container.State.Health.FailingStreak,
 			},
 		},
 		Name:         strings.TrimLeft(container.Name, "/"),
@@ -517,12 +720,88 @@ func (g *generator) inspectContainer(id string, networks map[string]docker.Netwo
 		IP:           containerNetSettings.IPAddress,
 		IP6LinkLocal: containerNetSettings.LinkLocalIPv6Address,
 		IP6Global:    containerNetSettings.GlobalIPv6Address,
+		Path:         container.Path,
+		Args:         container.Args,
+		Command:      containerConfig.Cmd,
+		Entrypoint:   containerConfig.Entrypoint,
+		User:         containerConfig.User,
+		WorkingDir:   containerConfig.WorkingDir,
+		RestartPolicy: context.RestartPolicy{
+			Name:              containerHostConfig.RestartPolicy.Name,
+			MaximumRetryCount: containerHostConfig.RestartPolicy.MaximumRetryCount,
+		},
+		RestartCount: container.RestartCount,
+		Platform:     container.Platform,
+		StopSignal:   containerConfig.StopSignal,
+		Resources: context.Resources{
+			Memory:            containerHostConfig.Memory,
+			MemoryReservation: containerHostConfig.MemoryReservation,
+			MemorySwap:        containerHostConfig.MemorySwap,
+			NanoCPUs:          containerHostConfig.NanoCPUs,
+			CPUShares:         containerHostConfig.CPUShares,
+			CPUQuota:          containerHostConfig.CPUQuota,
+			CPUPeriod:         containerHostConfig.CPUPeriod,
+			CPUSetCPUs:        containerHostConfig.CPUSetCPUs,
+			CPUSetMems:        containerHostConfig.CPUSetMEMs,
+			Sysctls:           containerHostConfig.Sysctls,
+			ShmSize:           containerHostConfig.ShmSize,
+			CapAdd:            containerHostConfig.CapAdd,
+			CapDrop:           containerHostConfig.CapDrop,
+			Privileged:        containerHostConfig.Privileged,
+			ReadonlyRootfs:    containerHostConfig.ReadonlyRootfs,
+			SecurityOpt:       containerHostConfig.SecurityOpt,
+		},
+		LogPath: container.LogPath,
+		LogConfig: context.LogConfig{
+			Driver:  containerHostConfig.LogConfig.Type,
+			Options: containerHostConfig.LogConfig.Config,
+		},
+	}
+
+	if container.Image != "" {
+		image, err := g.inspectImage(container.Image)
+		if err != nil {
+			log.Printf("Error inspecting image of container %s: %s: %s\n", runtimeContainer.Name, container.Image, err)
+		} else {
+			runtimeContainer.ImageDetails = newImageInfo(image)
+		}
+	}
+
+	if containerHostConfig.PidsLimit != nil {
+		runtimeContainer.Resources.PidsLimit = *containerHostConfig.PidsLimit
+	}
+	for _, v := range containerHostConfig.Ulimits {
+		runtimeContainer.Resources.Ulimits = append(runtimeContainer.Resources.Ulimits, context.Ulimit{
+			Name: v.Name,
+			Soft: v.Soft,
+			Hard: v.Hard,
+		})
+	}
+
+	for _, v := range container.State.Health.Log {
+		runtimeContainer.State.Health.Log = append(runtimeContainer.State.Health.Log, context.HealthLog{
+			Start:    v.Start,
+			End:      v.End,
+			ExitCode: v.ExitCode,
+			Output:   v.Output,
+		})
+	}
+	if healthcheck := containerConfig.Healthcheck; healthcheck != nil {
+		runtimeContainer.State.Health.Config = context.HealthConfig{
+			Test:          healthcheck.Test,
+			Interval:      healthcheck.Interval,
+			Timeout:       healthcheck.Timeout,
+			StartPeriod:   healthcheck.StartPeriod,
+			StartInterval: healthcheck.StartInterval,
+			Retries:       healthcheck.Retries,
+		}
 	}
 
 	addresses := context.GetContainerAddresses(container)
 	runtimeContainer.Addresses = append(runtimeContainer.Addresses, addresses...)
 
 	for k, v := range containerNetSettings.Networks {
+		apiNetwork := networks[k]
 		network := context.Network{
 			IP:                  v.IPAddress,
 			Name:                k,
@@ -534,7 +813,18 @@ func (g *generator) inspectContainer(id string, networks map[string]docker.Netwo
 			MacAddress:          v.MacAddress,
 			GlobalIPv6PrefixLen: v.GlobalIPv6PrefixLen,
 			IPPrefixLen:         v.IPPrefixLen,
-			Internal:            networks[k].Internal,
+			Internal:            apiNetwork.Internal,
+			ID:                  v.NetworkID,
+			DNSNames:            v.DNSNames,
+			LinkLocalIPs:        inspected.EndpointIPAM[k].LinkLocalIPs,
+			Driver:              apiNetwork.Driver,
+			Scope:               apiNetwork.Scope,
+			EnableIPv6:          apiNetwork.EnableIPv6,
+			Attachable:          apiNetwork.Attachable,
+			Ingress:             apiNetwork.Ingress,
+			IPAM:                newIPAM(apiNetwork.IPAM),
+			Labels:              apiNetwork.Labels,
+			Options:             apiNetwork.Options,
 		}
 
 		runtimeContainer.Networks = append(runtimeContainer.Networks,
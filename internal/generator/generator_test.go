@@ -1,11 +1,17 @@
 package generator
 
 import (
+	"archive/tar"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"testing/synctest"
@@ -23,6 +29,19 @@ func newStartEvent() *docker.APIEvents {
 	return &docker.APIEvents{Type: "container", Action: "start"}
 }
 
+// newTestClient returns a client of a test server serving handler, usually a
+// dockertest server with custom handlers.
+func newTestClient(t *testing.T, handler http.Handler) *docker.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := dockerclient.NewDockerClient("tcp://"+strings.TrimPrefix(server.URL, "http://"), false, "", "", "")
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	return client
+}
+
 func TestNewDebounceChannel(t *testing.T) {
 	orig := log.Writer()
 	log.SetOutput(io.Discard)
@@ -249,6 +268,474 @@ func TestGetContainersDevices(t *testing.T) {
 	}, containers[0].Devices)
 }
 
+func TestGetContainersRuntimeDetails(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+	containerID := "run123456789abcd"
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	finishedAt := startedAt.Add(time.Minute)
+	pidsLimit := int64(100)
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+	server.CustomHandler("/info", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Containers":1,"Images":1,"NFd":11,"NGoroutines":21}`))
+	}))
+	server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"19.03.12","Os":"Linux","GoVersion":"go1.13.14","Arch":"amd64","ApiVersion":"1.40"}`))
+	}))
+	server.CustomHandler("/networks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	server.CustomHandler("/containers/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]docker.APIContainers{{ID: containerID, Names: []string{"/run-test"}}})
+	}))
+	server.CustomHandler(fmt.Sprintf("/containers/%s/json", containerID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(docker.Container{
+			ID:   containerID,
+			Name: "/run-test",
+			Path: "/docker-entrypoint.sh",
+			Args: []string{"nginx", "-g", "daemon off;"},
+			Config: &docker.Config{
+				Cmd:        []string{"nginx", "-g", "daemon off;"},
+				Entrypoint: []string{"/docker-entrypoint.sh"},
+				User:       "nginx",
+				WorkingDir: "/srv",
+				StopSignal: "SIGQUIT",
+				Healthcheck: &docker.HealthConfig{
+					Test:        []string{"CMD-SHELL", "curl -f http://localhost/"},
+					Interval:    30 * time.Second,
+					Timeout:     5 * time.Second,
+					StartPeriod: time.Minute,
+					Retries:     3,
+				},
+			},
+			HostConfig: &docker.HostConfig{
+				RestartPolicy:  docker.RestartPolicy{Name: "on-failure", MaximumRetryCount: 5},
+				Memory:         512 << 20,
+				MemorySwap:     1 << 30,
+				NanoCPUs:       1500000000,
+				CPUSetCPUs:     "0-1",
+				PidsLimit:      &pidsLimit,
+				Ulimits:        []docker.ULimit{{Name: "nofile", Soft: 1024, Hard: 4096}},
+				Sysctls:        map[string]string{"net.core.somaxconn": "1024"},
+				CapAdd:         []string{"NET_ADMIN"},
+				CapDrop:        []string{"ALL"},
+				ReadonlyRootfs: true,
+				SecurityOpt:    []string{"no-new-privileges"},
+				LogConfig:      docker.LogConfig{Type: "json-file", Config: map[string]string{"max-size": "10m"}},
+			},
+			State: docker.State{
+				Status:     "restarting",
+				Restarting: true,
+				OOMKilled:  true,
+				ExitCode:   137,
+				StartedAt:  startedAt,
+				FinishedAt: finishedAt,
+				Health: docker.Health{
+					Status:        "unhealthy",
+					FailingStreak: 2,
+					Log: []docker.HealthCheck{
+						{Start: startedAt, End: startedAt.Add(time.Second), ExitCode: 1, Output: "connection refused"},
+					},
+				},
+			},
+			RestartCount: 3,
+			Platform:     "linux",
+			LogPath:      "/var/lib/docker/containers/run123456789abcd/run123456789abcd-json.log",
+		})
+	}))
+
+	client := newTestClient(t, server)
+	client.SkipServerVersionCheck = true
+
+	apiVersion, err := client.Version()
+	if err != nil {
+		t.Fatalf("failed to retrieve version: %s", err)
+	}
+	context.SetDockerEnv(apiVersion)
+
+	g := &generator{Client: client, Endpoint: client.Endpoint()}
+	containers, err := g.getContainers(config.Config{})
+	assert.NoError(t, err)
+	assert.Len(t, containers, 1)
+	container := containers[0]
+	assert.Equal(t, "/docker-entrypoint.sh", container.Path)
+	assert.Equal(t, []string{"nginx", "-g", "daemon off;"}, container.Args)
+	assert.Equal(t, []string{"nginx", "-g", "daemon off;"}, container.Command)
+	assert.Equal(t, []string{"/docker-entrypoint.sh"}, container.Entrypoint)
+	assert.Equal(t, "nginx", container.User)
+	assert.Equal(t, "/srv", container.WorkingDir)
+	assert.Equal(t, context.RestartPolicy{Name: "on-failure", MaximumRetryCount: 5}, container.RestartPolicy)
+	assert.Equal(t, 3, container.RestartCount)
+	assert.Equal(t, "linux", container.Platform)
+	assert.Equal(t, "SIGQUIT", container.StopSignal)
+	assert.Equal(t, context.Resources{
+		Memory:         512 << 20,
+		MemorySwap:     1 << 30,
+		NanoCPUs:       1500000000,
+		CPUSetCPUs:     "0-1",
+		PidsLimit:      100,
+		Ulimits:        []context.Ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}},
+		Sysctls:        map[string]string{"net.core.somaxconn": "1024"},
+		CapAdd:         []string{"NET_ADMIN"},
+		CapDrop:        []string{"ALL"},
+		ReadonlyRootfs: true,
+		SecurityOpt:    []string{"no-new-privileges"},
+	}, container.Resources)
+	assert.Equal(t, "/var/lib/docker/containers/run123456789abcd/run123456789abcd-json.log", container.LogPath)
+	assert.Equal(t, context.LogConfig{Driver: "json-file", Options: map[string]string{"max-size": "10m"}}, container.LogConfig)
+	assert.Equal(t, context.State{
+		Status:     "restarting",
+		Restarting: true,
+		OOMKilled:  true,
+		ExitCode:   137,
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+		Health: context.Health{
+			Status:        "unhealthy",
+			FailingStreak: 2,
+			Log: []context.HealthLog{
+				{Start: startedAt, End: startedAt.Add(time.Second), ExitCode: 1, Output: "connection refused"},
+			},
+			Config: context.HealthConfig{
+				Test:        []string{"CMD-SHELL", "curl -f http://localhost/"},
+				Interval:    30 * time.Second,
+				Timeout:     5 * time.Second,
+				StartPeriod: time.Minute,
+				Retries:     3,
+			},
+		},
+	}, container.State)
+}
+
+func TestGetContainersImageDetails(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+	containerID := "img123456789abcd"
+	imageID := "sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"
+	created := time.Date(2024, 4, 2, 8, 0, 0, 0, time.UTC)
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+	server.CustomHandler("/info", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Containers":1,"Images":1,"NFd":11,"NGoroutines":21}`))
+	}))
+	server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"19.03.12","Os":"Linux","GoVersion":"go1.13.14","Arch":"amd64","ApiVersion":"1.40"}`))
+	}))
+	server.CustomHandler("/networks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	removed := false
+	server.CustomHandler("/containers/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if removed {
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode([]docker.APIContainers{{ID: containerID, Names: []string{"/img-test"}}})
+	}))
+	server.CustomHandler(fmt.Sprintf("/containers/%s/json", containerID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(docker.Container{
+			ID:     containerID,
+			Name:   "/img-test",
+			Image:  imageID,
+			Config: &docker.Config{Image: "nginx:1.27@sha256:0c86dddac19f2ce4fd716ac58c0fd87bf69bfd4edabfd6971fb885bafd12a00b"},
+		})
+	}))
+	inspections := 0
+	server.CustomHandler(fmt.Sprintf("/images/%s/json", imageID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inspections++
+		json.NewEncoder(w).Encode(docker.Image{
+			ID:           imageID,
+			RepoDigests:  []string{"nginx@sha256:0c86dddac19f2ce4fd716ac58c0fd87bf69bfd4edabfd6971fb885bafd12a00b"},
+			Created:      created,
+			Architecture: "amd64",
+			OS:           "linux",
+			Config: &docker.Config{
+				Labels:       map[string]string{"org.opencontainers.image.version": "1.27.0"},
+				Env:          []string{"NGINX_VERSION=1.27.0"},
+				ExposedPorts: map[docker.Port]struct{}{"80/tcp": {}, "443/tcp": {}},
+			},
+		})
+	}))
+
+	client := newTestClient(t, server)
+	client.SkipServerVersionCheck = true
+
+	apiVersion, err := client.Version()
+	if err != nil {
+		t.Fatalf("failed to retrieve version: %s", err)
+	}
+	context.SetDockerEnv(apiVersion)
+
+	g := &generator{Client: client, Endpoint: client.Endpoint()}
+	for range 2 {
+		containers, err := g.getContainers(config.Config{})
+		assert.NoError(t, err)
+		assert.Len(t, containers, 1)
+		assert.Equal(t, context.DockerImage{
+			Repository:   "nginx",
+			Tag:          "1.27",
+			Digest:       "sha256:0c86dddac19f2ce4fd716ac58c0fd87bf69bfd4edabfd6971fb885bafd12a00b",
+			Domain:       "docker.io",
+			Path:         "library/nginx",
+			FamiliarName: "nginx",
+			Canonical:    "docker.io/library/nginx:1.27@sha256:0c86dddac19f2ce4fd716ac58c0fd87bf69bfd4edabfd6971fb885bafd12a00b",
+		}, containers[0].Image)
+		assert.Equal(t, &context.ImageInfo{
+			ID:           imageID,
+			RepoDigests:  []string{"nginx@sha256:0c86dddac19f2ce4fd716ac58c0fd87bf69bfd4edabfd6971fb885bafd12a00b"},
+			Created:      created,
+			Architecture: "amd64",
+			OS:           "linux",
+			Labels:       map[string]string{"org.opencontainers.image.version": "1.27.0"},
+			ExposedPorts: []string{"443/tcp", "80/tcp"},
+			Env:          map[string]string{"NGINX_VERSION": "1.27.0"},
+		}, containers[0].ImageDetails)
+	}
+	assert.Equal(t, 1, inspections)
+	assert.Len(t, g.images, 1)
+
+	// The image of the current container stays cached even if it is not listed.
+	removed = true
+	g.getCurrentContainerID = func(...string) string { return containerID }
+	t.Cleanup(func() { context.SetCurrentContainerID("") })
+	_, err = g.getContainers(config.Config{})
+	assert.NoError(t, err)
+	assert.Len(t, g.images, 1)
+	assert.Equal(t, 1, inspections)
+
+	// The image is no longer cached once no container uses it.
+	g.getCurrentContainerID = nil
+	_, err = g.getContainers(config.Config{})
+	assert.NoError(t, err)
+	assert.Empty(t, g.images)
+}
+
+func TestParseImageLogsInvalidReferencesOnce(t *testing.T) {
+	orig := log.Writer()
+	out := new(bytes.Buffer)
+	log.SetOutput(out)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	for range 2 {
+		assert.Equal(t, context.DockerImage{Repository: "Invalid:"}, parseImage("Invalid:"))
+	}
+	assert.Equal(t, 1, strings.Count(out.String(), "Error parsing image reference"))
+}
+
+func TestGetContainersNetworkDetails(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+	containerID := "net123456789abcd"
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+	server.CustomHandler("/info", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Containers":1,"Images":1,"NFd":11,"NGoroutines":21}`))
+	}))
+	server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"19.03.12","Os":"Linux","GoVersion":"go1.13.14","Arch":"amd64","ApiVersion":"1.40"}`))
+	}))
+	server.CustomHandler("/networks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]dockerclient.Network{{
+			Network: docker.Network{
+				Name:       "backend",
+				ID:         "backendnetworkid",
+				Scope:      "swarm",
+				Driver:     "overlay",
+				EnableIPv6: true,
+				IPAM: docker.IPAMOptions{
+					Driver: "default",
+					Config: []docker.IPAMConfig{
+						{Subnet: "172.20.0.0/16", IPRange: "172.20.10.0/24", Gateway: "172.20.0.1"},
+						{Subnet: "fd00:20::/64", Gateway: "fd00:20::1"},
+					},
+				},
+				Internal: true,
+				Labels:   map[string]string{"com.docker.compose.network": "backend"},
+				Options:  map[string]string{"com.docker.network.driver.overlay.vxlanid_list": "4097"},
+			},
+			Attachable: true,
+		}})
+	}))
+	server.CustomHandler("/containers/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]docker.APIContainers{{ID: containerID, Names: []string{"/net-test"}}})
+	}))
+	server.CustomHandler(fmt.Sprintf("/containers/%s/json", containerID), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{
+			"Id": %q,
+			"Name": "/net-test",
+			"NetworkSettings": {
+				"Networks": {
+					"backend": {
+						"IPAMConfig": {"LinkLocalIPs": ["169.254.10.2", "fe80::10:2"]},
+						"IPAddress": "172.20.10.2",
+						"IPPrefixLen": 16,
+						"Gateway": "172.20.0.1",
+						"NetworkID": "backendnetworkid",
+						"DNSNames": ["net-test", "net123456789"]
+					}
+				}
+			}
+		}`, containerID)
+	}))
+
+	client := newTestClient(t, server)
+	client.SkipServerVersionCheck = true
+
+	apiVersion, err := client.Version()
+	if err != nil {
+		t.Fatalf("failed to retrieve version: %s", err)
+	}
+	context.SetDockerEnv(apiVersion)
+
+	g := &generator{Client: client, Endpoint: client.Endpoint()}
+	containers, err := g.getContainers(config.Config{})
+	assert.NoError(t, err)
+	assert.Len(t, containers, 1)
+	assert.Equal(t, []context.Network{{
+		IP:           "172.20.10.2",
+		Name:         "backend",
+		Aliases:      []string{},
+		Gateway:      "172.20.0.1",
+		IPPrefixLen:  16,
+		Internal:     true,
+		ID:           "backendnetworkid",
+		DNSNames:     []string{"net-test", "net123456789"},
+		LinkLocalIPs: []string{"169.254.10.2", "fe80::10:2"},
+		Driver:       "overlay",
+		Scope:        "swarm",
+		EnableIPv6:   true,
+		Attachable:   true,
+		IPAM: context.IPAM{
+			Driver: "default",
+			Config: []context.IPAMConfig{
+				{Subnet: "172.20.0.0/16", IPRange: "172.20.10.0/24", Gateway: "172.20.0.1"},
+				{Subnet: "fd00:20::/64", Gateway: "fd00:20::1"},
+			},
+		},
+		Labels:  map[string]string{"com.docker.compose.network": "backend"},
+		Options: map[string]string{"com.docker.network.driver.overlay.vxlanid_list": "4097"},
+	}}, containers[0].Networks)
+
+	ctx := context.Context(containers)
+	networks := ctx.Networks()
+	assert.Len(t, networks, 1)
+	assert.Equal(t, "backendnetworkid", networks[0].ID)
+	assert.Equal(t, []string{containerID}, networks[0].Containers)
+	assert.Len(t, networks[0].IPAM.Config, 2)
+	assert.True(t, networks[0].Attachable)
+}
+
+func TestGetContainersServerInfo(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+	infoRequests := 0
+	server.CustomHandler("/info", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		infoRequests++
+		w.Write([]byte(`{
+			"ID": "daemon-id",
+			"Name": "docker-host",
+			"Containers": 0,
+			"Images": 3,
+			"Labels": ["zone=eu-west-1a"],
+			"NCPU": 8,
+			"MemTotal": 16777216000,
+			"KernelVersion": "6.8.0",
+			"Driver": "overlay2",
+			"LoggingDriver": "json-file",
+			"CgroupDriver": "systemd",
+			"RegistryConfig": {"Mirrors": ["https://mirror.example.com/"]},
+			"Runtimes": {"runc": {"path": "runc"}, "io.containerd.runc.v2": {"path": "runc"}},
+			"DefaultRuntime": "runc",
+			"SecurityOptions": ["name=seccomp,profile=builtin", "name=rootless"],
+			"Swarm": {"NodeID": "node-id", "NodeAddr": "10.0.0.2", "LocalNodeState": "active", "ControlAvailable": true, "Cluster": {"ID": "cluster-id"}}
+		}`))
+	}))
+	server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"19.03.12","Os":"Linux","GoVersion":"go1.13.14","Arch":"amd64","ApiVersion":"1.40"}`))
+	}))
+	server.CustomHandler("/nodes/node-id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ID": "node-id", "ManagerStatus": {"Leader": true, "Reachability": "reachable", "Addr": "10.0.0.2:2377"}}`))
+	}))
+	server.CustomHandler("/networks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	server.CustomHandler("/containers/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+
+	client := newTestClient(t, server)
+	client.SkipServerVersionCheck = true
+
+	apiVersion, err := client.Version()
+	if err != nil {
+		t.Fatalf("failed to retrieve version: %s", err)
+	}
+	context.SetDockerEnv(apiVersion)
+
+	g := &generator{Client: client, Endpoint: client.Endpoint()}
+	for range 2 {
+		_, err := g.getContainers(config.Config{})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, infoRequests, "server info should be cached")
+
+	var ctx context.Context
+	assert.Equal(t, context.Docker{
+		Name:            "docker-host",
+		NumImages:       3,
+		Version:         "19.03.12",
+		ApiVersion:      "1.40",
+		GoVersion:       "go1.13.14",
+		OperatingSystem: "Linux",
+		Architecture:    "amd64",
+		ID:              "daemon-id",
+		Labels:          map[string]string{"zone": "eu-west-1a"},
+		NCPU:            8,
+		MemTotal:        16777216000,
+		KernelVersion:   "6.8.0",
+		StorageDriver:   "overlay2",
+		LoggingDriver:   "json-file",
+		CgroupDriver:    "systemd",
+		RegistryMirrors: []string{"https://mirror.example.com/"},
+		Runtimes:        []string{"io.containerd.runc.v2", "runc"},
+		DefaultRuntime:  "runc",
+		SecurityOptions: []string{"name=seccomp,profile=builtin", "name=rootless"},
+		Rootless:        true,
+		Swarm: context.DockerSwarm{
+			NodeID:         "node-id",
+			NodeAddr:       "10.0.0.2",
+			LocalNodeState: "active",
+			Role:           "manager",
+			ClusterID:      "cluster-id",
+			Leader:         true,
+			Reachability:   "reachable",
+		},
+	}, ctx.Docker())
+}
+
 func TestGetContainersSetsCurrentContainer(t *testing.T) {
 	orig := log.Writer()
 	log.SetOutput(io.Discard)
@@ -305,3 +792,1019 @@ func TestGetContainersSetsCurrentContainer(t *testing.T) {
 	assert.NotNil(t, current)
 	assert.Equal(t, currentID, current.ID)
 }
+
+func TestGenerateFileToContainer(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+
+	var uploaded []byte
+	var uploadPath string
+	server.CustomHandler("/containers/nginx/archive", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if uploaded == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(uploaded)
+		case http.MethodPut:
+			uploadPath = r.URL.Query().Get("path")
+			uploaded, _ = io.ReadAll(r.Body)
+		}
+	}))
+
+	client := newTestClient(t, server)
+
+	tmpl, err := os.CreateTemp(t.TempDir(), "*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.WriteString("{{ len $ }} containers\n")
+	tmpl.Close()
+
+	g := &generator{Client: client, Endpoint: client.Endpoint()}
+	cfg := config.Config{
+		Template: tmpl.Name(),
+		Dest:     "container://nginx:/etc/nginx/conf.d/default.conf",
+	}
+
+	assert.True(t, g.generateFile(cfg, context.Context{}).changed, "first render should upload the file")
+	assert.Equal(t, "/etc/nginx/conf.d", uploadPath)
+
+	tr := tar.NewReader(bytes.NewReader(uploaded))
+	header, err := tr.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "default.conf", header.Name)
+	contents, _ := io.ReadAll(tr)
+	assert.Equal(t, "0 containers\n", string(contents))
+
+	assert.False(t, g.generateFile(cfg, context.Context{}).changed, "identical render should not upload again")
+
+	// The mode and owner of the existing file are kept when it is replaced.
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "default.conf", Mode: 0600, Uid: 101, Gid: 102, Size: 3})
+	tw.Write([]byte("old"))
+	tw.Close()
+	uploaded = buf.Bytes()
+
+	result := g.generateFile(cfg, context.Context{})
+	assert.True(t, result.changed, "changed contents should be uploaded")
+	header, err = tar.NewReader(bytes.NewReader(uploaded)).Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0600), header.Mode)
+	assert.Equal(t, 101, header.Uid)
+	assert.Equal(t, 102, header.Gid)
+
+	// So are they when the previous contents are rolled back.
+	g.rollback(cfg, result)
+	tr = tar.NewReader(bytes.NewReader(uploaded))
+	header, err = tr.Next()
+	assert.NoError(t, err)
+	contents, _ = io.ReadAll(tr)
+	assert.Equal(t, "old", string(contents))
+	assert.Equal(t, int64(0600), header.Mode)
+	assert.Equal(t, 101, header.Uid)
+	assert.Equal(t, 102, header.Gid)
+}
+
+func TestGenerateFileKeepsChangesOfFailedWrites(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	failing := true
+	var uploaded []byte
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		case failing:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			tr := tar.NewReader(r.Body)
+			tr.Next()
+			uploaded, _ = io.ReadAll(tr)
+		}
+	}))
+
+	tmpl := t.TempDir() + "/test.tmpl"
+	if err := os.WriteFile(tmpl, []byte("{{ range .Changes.Added }}+{{ .Name }} {{ end }}{{ len $ }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g := &generator{Client: client}
+	cfg := config.Config{Template: tmpl, Dest: "container://nginx:/etc/nginx/conf.d/default.conf"}
+	containers := context.Context{{ID: "1", Name: "web"}}
+
+	assert.False(t, g.generateFile(cfg, containers).changed, "failed write")
+
+	failing = false
+	result := g.generateFile(cfg, containers)
+	assert.True(t, result.changed)
+	assert.Equal(t, []context.ContainerRef{{ID: "1", Name: "web"}}, result.changes.Added, "containers of the failed write are still reported")
+	assert.Equal(t, "+web 1", string(uploaded))
+}
+
+func TestNewContainerDestination(t *testing.T) {
+	dest, err := newContainerDestination(nil, "container://nginx:/etc/nginx/conf.d/default.conf")
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx", dest.container)
+	assert.Equal(t, "/etc/nginx/conf.d/default.conf", dest.path)
+
+	for _, invalid := range []string{
+		"container://nginx",
+		"container://:/etc/nginx/conf.d/default.conf",
+		"container://nginx:etc/nginx/conf.d/default.conf",
+		"container://nginx:/etc/nginx/conf.d/",
+	} {
+		_, err := newContainerDestination(nil, invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// fakeSwarm is a minimal in-memory implementation of the Swarm config and service endpoints.
+type fakeSwarm struct {
+	configs []dockerclient.SwarmConfig
+	service dockerclient.SwarmService
+	removed []string
+}
+
+func (f *fakeSwarm) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /configs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(f.configs)
+	})
+	mux.HandleFunc("POST /configs/create", func(w http.ResponseWriter, r *http.Request) {
+		var spec dockerclient.SwarmConfigSpec
+		json.NewDecoder(r.Body).Decode(&spec)
+		id := fmt.Sprintf("config%d", len(f.configs)+len(f.removed))
+		f.configs = append(f.configs, dockerclient.SwarmConfig{
+			ID:        id,
+			CreatedAt: time.Date(2024, 1, 1, 0, 0, len(f.configs)+len(f.removed), 0, time.UTC),
+			Spec:      spec,
+		})
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	})
+	mux.HandleFunc("GET /configs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range f.configs {
+			if c.ID == r.PathValue("id") {
+				json.NewEncoder(w).Encode(c)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("DELETE /configs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		for i, c := range f.configs {
+			if c.ID == r.PathValue("id") {
+				f.configs = append(f.configs[:i], f.configs[i+1:]...)
+				f.removed = append(f.removed, c.ID)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /services/proxy", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(f.service)
+	})
+	mux.HandleFunc("POST /services/proxy/update", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("version") != fmt.Sprint(f.service.Version.Index) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.service.Spec = nil
+		json.NewDecoder(r.Body).Decode(&f.service.Spec)
+		f.service.Version.Index++
+	})
+	return mux
+}
+
+func TestGenerateFileToSwarmConfig(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	swarm := &fakeSwarm{service: dockerclient.SwarmService{
+		ID:      "proxy",
+		Version: dockerclient.SwarmVersion{Index: 10},
+		Spec: map[string]any{
+			"Name": "proxy",
+			"TaskTemplate": map[string]any{
+				"ContainerSpec": map[string]any{
+					"Image": "nginx",
+					"Configs": []any{
+						map[string]any{"ConfigID": "other", "ConfigName": "other", "File": map[string]any{"Name": "/other"}},
+					},
+				},
+			},
+		},
+	}}
+	client := newTestClient(t, swarm.handler())
+
+	dir := t.TempDir()
+	tmplPath := dir + "/proxy.tmpl"
+	g := &generator{Client: client}
+	cfg := config.Config{
+		Template: tmplPath,
+		Dest:     "swarm-config://proxy-conf?service=proxy&target=/etc/nginx/conf.d/default.conf&keep=2",
+	}
+	render := func(contents string) bool {
+		if err := os.WriteFile(tmplPath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return g.generateFile(cfg, context.Context{}).changed
+	}
+
+	assert.True(t, render("v1\n"))
+	assert.False(t, render("v1\n"), "unchanged contents should not create a new version")
+	assert.True(t, render("v2\n"))
+	assert.True(t, render("v3\n"))
+
+	// only the newest two versions are kept
+	assert.Len(t, swarm.configs, 2)
+	assert.Equal(t, []string{"config0"}, swarm.removed)
+	for _, c := range swarm.configs {
+		assert.Equal(t, "proxy-conf", c.Spec.Labels[swarmConfigLabel])
+		assert.True(t, strings.HasPrefix(c.Spec.Name, "proxy-conf-"))
+	}
+
+	// the service mounts the newest version and keeps unrelated configs
+	refs := serviceConfigReferences(swarm.service.Spec)
+	assert.Len(t, refs, 2)
+	assert.Equal(t, "other", refs[0].(map[string]any)["ConfigID"])
+	latest := refs[1].(map[string]any)
+	assert.Equal(t, swarm.configs[1].ID, latest["ConfigID"])
+	assert.Equal(t, "/etc/nginx/conf.d/default.conf", latest["File"].(map[string]any)["Name"])
+	assert.Equal(t, "v3\n", string(swarm.configs[1].Spec.Data))
+	assert.Equal(t, uint64(13), swarm.service.Version.Index)
+}
+
+func TestNewSwarmConfigDestination(t *testing.T) {
+	dest, err := newSwarmConfigDestination(nil, "swarm-config://proxy-conf?service=proxy")
+	assert.NoError(t, err)
+	assert.Equal(t, "proxy-conf", dest.name)
+	assert.Equal(t, "proxy", dest.service)
+	assert.Equal(t, "/proxy-conf", dest.target)
+	assert.Equal(t, 2, dest.keep)
+
+	for _, invalid := range []string{
+		"swarm-config://",
+		"swarm-config://proxy-conf/extra",
+		"swarm-config://proxy-conf?keep=0",
+		"swarm-config://proxy-conf?keep=abc",
+	} {
+		_, err := newSwarmConfigDestination(nil, invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSwarmConfigIsVersionReference(t *testing.T) {
+	dest, err := newSwarmConfigDestination(nil, "swarm-config://proxy")
+	assert.NoError(t, err)
+
+	for name, expected := range map[string]bool{
+		"proxy-0123456789ab":      true,
+		"proxy-conf-0123456789ab": false,
+		"proxy-conf":              false,
+		"proxy-0123456789abc":     false,
+		"proxy-0123456789AB":      false,
+		"proxy":                   false,
+	} {
+		assert.Equal(t, expected, dest.isVersionReference(map[string]any{"ConfigName": name}), name)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		a, b string
+		want string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", ""},
+		{"changed line", "a\nb\nc\n", "a\nx\nc\n", "-b\n+x\n"},
+		{"added line", "a\nc\n", "a\nb\nc\n", "+b\n"},
+		{"removed file", "a\nb\n", "", "-a\n-b\n"},
+		{"interleaved", "a\nb\nc\nd\n", "a\nc\ne\nd\n", "-b\n+e\n"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.want, diffLines(tc.a, tc.b))
+		})
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	dir := t.TempDir()
+	tmplPath := dir + "/test.tmpl"
+	if err := os.WriteFile(tmplPath, []byte("generated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		action   string
+		restored bool
+		want     string
+	}{
+		{config.DriftActionRestore, true, "generated\n"},
+		{config.DriftActionReport, false, "edited\n"},
+	} {
+		t.Run(tc.action, func(t *testing.T) {
+			g := &generator{}
+			cfg := config.Config{
+				Template:    tmplPath,
+				Dest:        dir + "/" + tc.action + ".conf",
+				DriftAction: tc.action,
+			}
+
+			assert.Nil(t, g.checkDrift(cfg), "nothing rendered yet")
+			assert.True(t, g.generateFile(cfg, context.Context{}).changed)
+			assert.Nil(t, g.checkDrift(cfg), "destination did not drift")
+
+			if err := os.WriteFile(cfg.Dest, []byte("edited\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.restored, g.checkDrift(cfg) != nil)
+
+			contents, err := os.ReadFile(cfg.Dest)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(contents))
+		})
+	}
+}
+
+func TestHooks(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	dir := t.TempDir()
+	tmplPath := dir + "/test.tmpl"
+	if err := os.WriteFile(tmplPath, []byte("contents\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := dir + "/hooks"
+	hook := `echo "$DOCKER_GEN_HOOK $DOCKER_GEN_CONFIG $DOCKER_GEN_ERROR" >> ` + out
+	cfg := config.Config{
+		Name:               "app",
+		Template:           tmplPath,
+		Dest:               dir + "/out.conf",
+		PreRender:          hook,
+		OnNoChange:         hook,
+		OnDockerDisconnect: hook,
+		OnDockerReconnect:  hook,
+	}
+	g := &generator{Configs: config.ConfigFile{Config: []config.Config{cfg, {Name: "other"}}}}
+
+	assert.True(t, g.generateFile(cfg, context.Context{}).changed)
+	assert.False(t, g.generateFile(cfg, context.Context{}).changed)
+	g.runDockerHook(hookOnDockerDisconnect, errors.New("connection refused"))
+	g.runDockerHook(hookOnDockerReconnect, nil)
+
+	contents, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "pre_render app \npre_render app \non_no_change app \non_docker_disconnect app connection refused\non_docker_reconnect app \n", string(contents))
+
+	cfg.PreRender = "exit 1"
+	if err := os.WriteFile(tmplPath, []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, g.generateFile(cfg, context.Context{}).changed, "failing pre_render skips the render")
+	contents, err = os.ReadFile(cfg.Dest)
+	assert.NoError(t, err)
+	assert.Equal(t, "contents\n", string(contents))
+
+	cfg.NotifyTimeout = 100 * time.Millisecond
+	start := time.Now()
+	assert.ErrorContains(t, g.runHook(cfg, hookOnNoChange, "sleep 5", nil), "timed out")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestNotifyPipeline(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	for _, tc := range []struct {
+		desc            string
+		continueOnError bool
+		want            string
+	}{
+		{"stops on error", false, "1\n"},
+		{"continues on error", true, "1\n3\n"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := t.TempDir() + "/out"
+			g := &generator{}
+			g.notify(config.Config{Notify: []config.NotifyStep{
+				{Type: config.NotifyCommand, Command: "echo 1 >> " + out},
+				{Type: config.NotifyCommand, Command: "exit 1", ContinueOnError: tc.continueOnError},
+				{Type: config.NotifyCommand, Command: "echo 3 >> " + out},
+			}}, renderResult{}, nil)
+
+			contents, err := os.ReadFile(out)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(contents))
+		})
+	}
+}
+
+func TestNotifyCommandStep(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+	origDelay := notifyRetryDelay
+	notifyRetryDelay = time.Millisecond
+	t.Cleanup(func() { notifyRetryDelay = origDelay })
+
+	dir := t.TempDir()
+	tmplPath := dir + "/test.tmpl"
+	cfg := config.Config{Template: tmplPath, Dest: dir + "/out.conf"}
+	g := &generator{}
+
+	var backups []string
+	for _, contents := range []string{"first\n", "second\n"} {
+		if err := os.WriteFile(tmplPath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result := g.generateFile(cfg, context.Context{})
+		assert.True(t, result.changed)
+		backups = append(backups, result.backup)
+
+		env := dir + "/env"
+		step := config.NotifyStep{
+			Type:    config.NotifyCommand,
+			Command: `echo "$DOCKER_GEN_CONFIG|$DOCKER_GEN_TEMPLATE|$DOCKER_GEN_DEST|$DOCKER_GEN_CHANGED|$DOCKER_GEN_BACKUP" > ` + env,
+		}
+		assert.NoError(t, g.runNotifyStep(cfg, step, result, nil))
+		out, err := os.ReadFile(env)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("%s|%s|%s|true|%s\n", cfg.Dest, cfg.Template, cfg.Dest, result.backup), string(out))
+	}
+
+	assert.Empty(t, backups[0], "nothing to back up on the first render")
+	backup, err := os.ReadFile(backups[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(backup))
+
+	changesStdin, changesFile := dir+"/stdin.json", dir+"/file.json"
+	result := renderResult{changes: context.Changes{
+		Removed: []context.ContainerRef{{ID: "1", Name: "web"}},
+		Changed: []context.ContainerRef{{ID: "2", Name: "api", Fields: []string{"Labels"}}},
+	}}
+	step := config.NotifyStep{
+		Type:    config.NotifyCommand,
+		Command: fmt.Sprintf(`cat > %s; cp "$DOCKER_GEN_CHANGES" %s`, changesStdin, changesFile),
+	}
+	assert.NoError(t, g.runNotifyStep(cfg, step, result, nil))
+	want := `{"added":[],"removed":[{"id":"1","name":"web"}],"changed":[{"id":"2","name":"api","fields":["Labels"]}]}`
+	for _, path := range []string{changesStdin, changesFile} {
+		changes, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.JSONEq(t, want, string(changes))
+	}
+
+	step = config.NotifyStep{Type: config.NotifyCommand, Command: "exec sleep 5", Timeout: 50 * time.Millisecond}
+	assert.ErrorContains(t, g.runNotifyStep(cfg, step, renderResult{}, nil), "timed out after 50ms")
+
+	attempts := dir + "/attempts"
+	step = config.NotifyStep{Type: config.NotifyCommand, Command: "echo >> " + attempts + "; exit 1", Retries: 2}
+	assert.Error(t, g.runNotifyStepWithRetries(cfg, step, renderResult{}, nil))
+	out, err := os.ReadFile(attempts)
+	assert.NoError(t, err)
+	assert.Equal(t, "\n\n\n", string(out))
+}
+
+func TestRollbackOnNotifyFailure(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	dir := t.TempDir()
+	tmplPath := dir + "/test.tmpl"
+	notified := dir + "/notified"
+	cfg := config.Config{
+		Template: tmplPath,
+		Dest:     dir + "/out.conf",
+		// reject the contents "bad", like a reload rejecting an invalid config
+		NotifyCmd:               `cat "$DOCKER_GEN_DEST" >> ` + notified + `; ! grep -q bad "$DOCKER_GEN_DEST"`,
+		RollbackOnNotifyFailure: true,
+	}
+	g := &generator{}
+	render := func(contents string, containers context.Context) renderResult {
+		if err := os.WriteFile(tmplPath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result := g.generateFile(cfg, containers)
+		if result.changed {
+			g.notify(cfg, result, nil)
+		}
+		return result
+	}
+	assertDest := func(want string) {
+		contents, err := os.ReadFile(cfg.Dest)
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(contents))
+	}
+
+	web := context.Context{{ID: "1", Name: "web"}}
+	render("good\n", web)
+	assertDest("good\n")
+
+	assert.True(t, render("bad\n", web).changed)
+	assertDest("good\n")
+	assert.False(t, render("bad\n", web).changed, "bad contents are not retried with the same containers")
+	assertDest("good\n")
+
+	assert.True(t, render("bad\n", context.Context{{ID: "2", Name: "api"}}).changed, "bad contents are retried once the containers change")
+	assertDest("good\n")
+
+	out, err := os.ReadFile(notified)
+	assert.NoError(t, err)
+	assert.Equal(t, "good\nbad\ngood\nbad\ngood\n", string(out))
+
+	// A failed notification on interval, which wrote nothing, has nothing to roll back.
+	logged := new(bytes.Buffer)
+	log.SetOutput(logged)
+	g.rollback(cfg, renderResult{contents: []byte("good\n")})
+	assert.Empty(t, logged.String())
+}
+
+func TestNotifyMinInterval(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	synctest.Test(t, func(t *testing.T) {
+		out := t.TempDir() + "/out"
+		cfg := config.Config{
+			Dest:              "/etc/app.conf",
+			NotifyCmd:         "echo $DOCKER_GEN_CHANGED >> " + out,
+			NotifyMinInterval: time.Second,
+		}
+		assertNotified := func(want string) {
+			t.Helper()
+			synctest.Wait()
+			contents, _ := os.ReadFile(out)
+			assert.Equal(t, want, string(contents))
+		}
+
+		g := &generator{}
+		g.notify(cfg, renderResult{changed: true}, nil)
+		assertNotified("true\n")
+
+		time.Sleep(100 * time.Millisecond)
+		g.notify(cfg, renderResult{changed: true}, nil)
+		g.notify(cfg, renderResult{changed: false}, nil)
+		assertNotified("true\n")
+
+		// the pending notification is delivered once, a second after the first one
+		time.Sleep(899 * time.Millisecond)
+		assertNotified("true\n")
+		time.Sleep(time.Millisecond)
+		assertNotified("true\ntrue\n")
+
+		time.Sleep(time.Second)
+		g.notify(cfg, renderResult{changed: true}, nil)
+		assertNotified("true\ntrue\ntrue\n")
+	})
+}
+
+func TestMergeResults(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	cfg := config.Config{Template: t.TempDir() + "/test.tmpl"}
+	web := context.ContainerRef{ID: "1", Name: "web"}
+
+	merged := mergeResults(cfg,
+		renderResult{changed: true, contents: []byte("b"), previous: []byte("a"), changes: context.Changes{Added: []context.ContainerRef{web}}},
+		renderResult{changed: false, contents: []byte("b")},
+	)
+
+	assert.True(t, merged.changed)
+	assert.Equal(t, []byte("b"), merged.contents)
+	assert.Equal(t, []byte("a"), merged.previous)
+	assert.Equal(t, []context.ContainerRef{web}, merged.changes.Added)
+	backup, err := os.ReadFile(merged.backup)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(backup))
+}
+
+func TestNotifySignalSteps(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+
+	var calls []string
+	server.CustomHandler("/containers/.*/(kill|restart)", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := strings.TrimPrefix(r.URL.Path, "/containers/")
+		if signal := r.URL.Query().Get("signal"); signal != "" {
+			call += " " + signal
+		}
+		calls = append(calls, call)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	client := newTestClient(t, server)
+
+	g := &generator{Client: client}
+	g.notify(config.Config{
+		NotifyContainers: map[string]int{"nginx": 1, "app": -1},
+		Notify: []config.NotifyStep{
+			{Type: config.NotifySignal, Containers: []string{"haproxy"}, Signal: "SIGUSR2"},
+			{Type: config.NotifyRestart, Containers: []string{"envoy"}},
+		},
+	}, renderResult{}, nil)
+
+	assert.Equal(t, []string{"app/restart", "nginx/kill 1", "haproxy/kill 12", "envoy/restart"}, calls)
+}
+
+func TestNotifyLifecycleSteps(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+	origInterval := healthPollInterval
+	healthPollInterval = time.Millisecond
+	t.Cleanup(func() { healthPollInterval = origInterval })
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+
+	var calls []string
+	server.CustomHandler("/containers/.*/(stop|start|pause|unpause|restart)", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := strings.TrimPrefix(r.URL.Path, "/containers/")
+		if timeout := r.URL.Query().Get("t"); timeout != "" {
+			call += " " + timeout
+		}
+		calls = append(calls, call)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	inspections := 0
+	server.CustomHandler("/containers/nginx/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inspections++
+		status := "starting"
+		if inspections == 3 {
+			status = "healthy"
+		}
+		json.NewEncoder(w).Encode(docker.Container{
+			ID:    "nginx",
+			State: docker.State{Running: true, Health: docker.Health{Status: status}},
+		})
+	}))
+
+	client := newTestClient(t, server)
+
+	g := &generator{Client: client}
+	cfg := config.Config{Notify: []config.NotifyStep{
+		{Type: config.NotifyPause, Containers: []string{"app"}},
+		{Type: config.NotifyStop, Containers: []string{"worker"}},
+		{Type: config.NotifyRestart, Containers: []string{"nginx"}, Timeout: 30 * time.Second, WaitHealthy: time.Minute},
+		{Type: config.NotifyStart, Containers: []string{"worker"}},
+		{Type: config.NotifyUnpause, Containers: []string{"app"}},
+	}}
+	assert.NoError(t, g.runNotifySteps(cfg, renderResult{}, nil))
+
+	assert.Equal(t, []string{"app/pause", "worker/stop 10", "nginx/restart 30", "worker/start", "app/unpause"}, calls)
+	assert.Equal(t, 3, inspections)
+
+	inspections = -100
+	step := config.NotifyStep{Type: config.NotifyStart, Containers: []string{"nginx"}, WaitHealthy: 10 * time.Millisecond}
+	assert.ErrorContains(t, g.runNotifyStep(cfg, step, renderResult{}, nil), "container 'nginx' still starting after 10ms")
+}
+
+func TestNotifyServiceUpdateStep(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	swarm := &fakeSwarm{service: dockerclient.SwarmService{
+		ID:      "proxy",
+		Version: dockerclient.SwarmVersion{Index: 7},
+		Spec:    map[string]any{"Name": "proxy", "TaskTemplate": map[string]any{"ForceUpdate": 2}},
+	}}
+	client := newTestClient(t, swarm.handler())
+
+	g := &generator{Client: client}
+	step := config.NotifyStep{Type: config.NotifyServiceUpdate, Services: []string{"proxy"}}
+	sent := make(notifications)
+	assert.NoError(t, g.runNotifyStep(config.Config{}, step, renderResult{}, sent))
+	assert.NoError(t, g.runNotifyStep(config.Config{}, step, renderResult{}, sent))
+
+	assert.Equal(t, uint64(8), swarm.service.Version.Index, "updated once per cycle")
+	assert.Equal(t, map[string]any{"Name": "proxy", "TaskTemplate": map[string]any{"ForceUpdate": float64(3)}}, swarm.service.Spec)
+}
+
+func TestNotifyDeduplicatesContainers(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+
+	var calls []string
+	server.CustomHandler("/containers/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]docker.APIContainers{{ID: "abc", Names: []string{"/nginx"}}})
+	}))
+	server.CustomHandler("/containers/.*/(kill|restart)", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := strings.TrimPrefix(r.URL.Path, "/containers/")
+		if signal := r.URL.Query().Get("signal"); signal != "" {
+			call += " " + signal
+		}
+		calls = append(calls, call)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	client := newTestClient(t, server)
+
+	g := &generator{Client: client}
+	configs := []config.Config{
+		{NotifyContainers: map[string]int{"nginx": 1}},
+		{NotifyContainersFilter: map[string][]string{"name": {"nginx"}}, NotifyContainersSignal: 1},
+		{NotifyContainersFilter: map[string][]string{"name": {"nginx"}}, NotifyContainersSignal: 10},
+		{NotifyContainers: map[string]int{"nginx": -1}},
+	}
+
+	sent := make(notifications)
+	for _, cfg := range configs {
+		g.notify(cfg, renderResult{changed: true}, sent)
+	}
+	assert.Equal(t, []string{"nginx/kill 1", "abc/kill 10", "nginx/restart"}, calls)
+
+	calls = nil
+	for _, cfg := range configs {
+		g.notify(cfg, renderResult{changed: true}, nil)
+	}
+	assert.Len(t, calls, 4, "every notification is delivered outside of a cycle")
+}
+
+func TestNotifyLabelOverrides(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+
+	var calls []string
+	server.CustomHandler("/containers/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]docker.APIContainers{
+			{ID: "nginx"},
+			{ID: "haproxy", Labels: map[string]string{"docker-gen.notify.signal": "SIGUSR2"}},
+			{ID: "envoy", Labels: map[string]string{"docker-gen.notify.action": "exec:/reload.sh", "docker-gen.notify.signal": "SIGUSR1"}},
+			{ID: "app", Labels: map[string]string{"docker-gen.notify.action": "restart"}},
+			{ID: "broken", Labels: map[string]string{"docker-gen.notify.action": "reload"}},
+		})
+	}))
+	server.CustomHandler("/containers/.*/(kill|restart)", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := strings.TrimPrefix(r.URL.Path, "/containers/")
+		if signal := r.URL.Query().Get("signal"); signal != "" {
+			call += " " + signal
+		}
+		calls = append(calls, call)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.CustomHandler("/containers/envoy/exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts docker.CreateExecOptions
+		json.NewDecoder(r.Body).Decode(&opts)
+		calls = append(calls, "envoy/exec "+opts.Cmd[2])
+		json.NewEncoder(w).Encode(map[string]string{"Id": "exec1"})
+	}))
+	server.CustomHandler("/exec/exec1/start", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.CustomHandler("/exec/exec1/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(docker.ExecInspect{ID: "exec1"})
+	}))
+
+	client := newTestClient(t, server)
+
+	g := &generator{Client: client}
+	step := config.NotifyStep{Type: config.NotifySignal, Filter: map[string][]string{"label": {"proxy"}}, Signal: "SIGHUP"}
+	err = g.runNotifyStep(config.Config{}, step, renderResult{}, nil)
+
+	assert.ErrorContains(t, err, `invalid docker-gen.notify.action label "reload"`)
+	assert.Equal(t, []string{"nginx/kill 1", "haproxy/kill 12", "envoy/exec /reload.sh", "app/restart"}, calls)
+
+	// Labels also override the restart requested by a legacy signal of -1.
+	calls = nil
+	cfg := config.Config{NotifyContainersFilter: map[string][]string{"label": {"proxy"}}, NotifyContainersSignal: -1}
+	err = g.runNotifyStep(cfg, cfg.NotifySteps()[0], renderResult{}, nil)
+
+	assert.ErrorContains(t, err, `invalid docker-gen.notify.action label "reload"`)
+	assert.Equal(t, []string{"nginx/restart", "haproxy/kill 12", "envoy/exec /reload.sh", "app/restart"}, calls)
+}
+
+func TestNotifyTemplateRequests(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+
+	var calls []string
+	server.CustomHandler("/containers/.*/kill", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, strings.TrimPrefix(r.URL.Path, "/containers/")+" "+r.URL.Query().Get("signal"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	client := newTestClient(t, server)
+
+	dir := t.TempDir()
+	tmplPath := dir + "/test.tmpl"
+	cfg := config.Config{
+		Template:         tmplPath,
+		Dest:             dir + "/out.conf",
+		NotifyContainers: map[string]int{"static": 1},
+	}
+	g := &generator{Client: client}
+	render := func(tmpl string) {
+		if err := os.WriteFile(tmplPath, []byte(tmpl), 0644); err != nil {
+			t.Fatal(err)
+		}
+		g.notify(cfg, g.generateFile(cfg, context.Context{}), nil)
+	}
+
+	render(`{{ notifyContainer "nginx" "SIGUSR1" }}upstream`)
+	assert.Equal(t, []string{"static/kill 1", "nginx/kill 10"}, calls)
+
+	calls = nil
+	render(`{{ notifySkip }}# comment`)
+	assert.Empty(t, calls)
+}
+
+func TestNotifyExecStep(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+
+	server, err := dockertest.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create test server: %s", err)
+	}
+	t.Cleanup(server.Stop)
+
+	var cmd []string
+	exitCode := 0
+	server.CustomHandler("/containers/nginx/exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts docker.CreateExecOptions
+		json.NewDecoder(r.Body).Decode(&opts)
+		cmd = opts.Cmd
+		json.NewEncoder(w).Encode(map[string]string{"Id": "exec1"})
+	}))
+	hang := false
+	release := make(chan struct{})
+	server.CustomHandler("/exec/exec1/start", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang {
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.CustomHandler("/exec/exec1/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(docker.ExecInspect{ID: "exec1", ExitCode: exitCode})
+	}))
+
+	client := newTestClient(t, server)
+	// release the hung handler before the server is closed, which waits for it
+	t.Cleanup(func() { close(release) })
+
+	g := &generator{Client: client}
+	step := config.NotifyStep{Type: config.NotifyExec, Containers: []string{"nginx"}, Command: "nginx -t && nginx -s reload"}
+
+	assert.NoError(t, g.runNotifyStep(config.Config{}, step, renderResult{}, nil))
+	assert.Equal(t, []string{"/bin/sh", "-c", "nginx -t && nginx -s reload"}, cmd)
+
+	exitCode = 1
+	assert.ErrorContains(t, g.runNotifyStep(config.Config{}, step, renderResult{}, nil), "exited with code 1")
+
+	hang = true
+	step.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	assert.ErrorContains(t, g.runNotifyStep(config.Config{}, step, renderResult{}, nil), "timed out after 100ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestNotifyHTTPStep(t *testing.T) {
+	orig := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(orig) })
+	origDelay := notifyRetryDelay
+	notifyRetryDelay = time.Millisecond
+	t.Cleanup(func() { notifyRetryDelay = origDelay })
+	t.Setenv("NOTIFY_TOKEN", "secret")
+
+	var requests int
+	var payload notifyPayload
+	var auth string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := renderResult{
+		changed:  true,
+		contents: []byte("upstream"),
+		changes: context.Changes{
+			Added: []context.ContainerRef{{ID: "1", Name: "web"}},
+		},
+	}
+	cfg := config.Config{Template: "nginx.tmpl", Dest: "/etc/nginx/conf.d/default.conf"}
+	step := config.NotifyStep{
+		Type:    config.NotifyHTTP,
+		Headers: map[string]string{"Authorization": "Bearer ${NOTIFY_TOKEN}"},
+		Retries: 1,
+	}
+
+	t.Run("tcp", func(t *testing.T) {
+		requests = 0
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+
+		step := step
+		step.URL = server.URL + "/hook"
+		assert.NoError(t, (&generator{}).runNotifyStepWithRetries(cfg, step, result, nil))
+		assert.Equal(t, 2, requests)
+		assert.Equal(t, "Bearer secret", auth)
+		assert.Equal(t, notifyPayload{
+			Config:   "/etc/nginx/conf.d/default.conf",
+			Template: "nginx.tmpl",
+			Dest:     "/etc/nginx/conf.d/default.conf",
+			Hash:     "sha256:1581e27de87bffae0bd4d745cd7964e68528d7a83e2e4c259a782d275df6f558",
+			Changed:  true,
+			Containers: payloadContainers{
+				Added:   []payloadContainer{{ID: "1", Name: "web"}},
+				Removed: []payloadContainer{},
+				Changed: []payloadContainer{},
+			},
+		}, payload)
+	})
+
+	t.Run("unix socket", func(t *testing.T) {
+		requests = 1
+		socket := t.TempDir() + "/hook.sock"
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Fatalf("failed to listen on socket: %s", err)
+		}
+		server := httptest.NewUnstartedServer(handler)
+		server.Listener = listener
+		server.Start()
+		t.Cleanup(server.Close)
+
+		step := step
+		step.URL = "http://localhost/hook"
+		step.Socket = socket
+		assert.NoError(t, (&generator{}).runNotifyStepWithRetries(cfg, step, result, nil))
+		assert.Equal(t, 2, requests)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		requests = 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(server.Close)
+
+		step := step
+		step.URL = server.URL
+		assert.ErrorContains(t, (&generator{}).runNotifyStepWithRetries(cfg, step, result, nil), "500 Internal Server Error")
+		assert.Equal(t, 2, requests)
+	})
+}
@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"log"
+	"time"
+
+	"github.com/nginx-proxy/docker-gen/internal/config"
+)
+
+// Hooks run at the other stages of a config besides notification.
+const (
+	hookPreRender          = "pre_render"
+	hookOnNoChange         = "on_no_change"
+	hookOnRenderError      = "on_render_error"
+	hookOnDockerDisconnect = "on_docker_disconnect"
+	hookOnDockerReconnect  = "on_docker_reconnect"
+
+	// defaultHookTimeout bounds hooks of configs without a notify_timeout.
+	defaultHookTimeout = time.Minute
+)
+
+// runHook runs command, the hook of cfg named hook, with /bin/sh -c. Besides
+// the variables describing the config, its environment has DOCKER_GEN_HOOK
+// and, if cause is not nil, DOCKER_GEN_ERROR. Hooks are killed after the
+// notify_timeout of the config, or defaultHookTimeout.
+func (g *generator) runHook(cfg config.Config, hook, command string, cause error) error {
+	if command == "" {
+		return nil
+	}
+
+	env := append(configEnv(cfg), "DOCKER_GEN_HOOK="+hook)
+	if cause != nil {
+		env = append(env, "DOCKER_GEN_ERROR="+cause.Error())
+	}
+	timeout := cfg.NotifyTimeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	err := g.runNotifyCmd(config.NotifyStep{Command: command, Timeout: timeout}, env, nil)
+	if err != nil {
+		log.Printf("Hook %s of %s failed: %s", hook, cfg.DisplayName(), err)
+	}
+	return err
+}
+
+// runDockerHook runs the docker connection hook of every config that has one.
+func (g *generator) runDockerHook(hook string, cause error) {
+	for _, cfg := range g.Configs.Config {
+		command := cfg.OnDockerReconnect
+		if hook == hookOnDockerDisconnect {
+			command = cfg.OnDockerDisconnect
+		}
+		g.runHook(cfg, hook, command, cause)
+	}
+}
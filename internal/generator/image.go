@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/nginx-proxy/docker-gen/internal/context"
+	"github.com/nginx-proxy/docker-gen/internal/dockerclient"
+	"github.com/nginx-proxy/docker-gen/internal/utils"
+)
+
+// inspectImage returns the image with the given ID. Image IDs are content
+// hashes, so inspections are cached while a container uses the image.
+func (g *generator) inspectImage(id string) (*docker.Image, error) {
+	g.imagesMu.Lock()
+	image, found := g.images[id]
+	g.imagesMu.Unlock()
+	if found {
+		return image, nil
+	}
+
+	image, err := g.Client.InspectImage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	g.imagesMu.Lock()
+	defer g.imagesMu.Unlock()
+	if g.images == nil {
+		g.images = make(map[string]*docker.Image)
+	}
+	g.images[id] = image
+	return image, nil
+}
+
+// evictImages records the images used by the containers listed for the config
+// with the given state key, and drops the cached images no config uses anymore.
+func (g *generator) evictImages(key string, containers []*context.RuntimeContainer) {
+	used := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		if container.ImageDetails != nil {
+			used[container.ImageDetails.ID] = true
+		}
+	}
+
+	g.imagesMu.Lock()
+	defer g.imagesMu.Unlock()
+	if g.imageUsers == nil {
+		g.imageUsers = make(map[string]map[string]bool)
+	}
+	g.imageUsers[key] = used
+	for id := range g.images {
+		inUse := false
+		for _, ids := range g.imageUsers {
+			if ids[id] {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			delete(g.images, id)
+		}
+	}
+}
+
+// invalidImageReferences holds the image references that failed to parse,
+// which are only logged the first time.
+var invalidImageReferences sync.Map
+
+// parseImage returns the image of a container from its image reference.
+// Invalid references are kept whole as the repository.
+func parseImage(reference string) context.DockerImage {
+	if reference == "" {
+		return context.DockerImage{}
+	}
+	ref, err := dockerclient.ParseImageReference(reference)
+	if err != nil {
+		if _, logged := invalidImageReferences.LoadOrStore(reference, true); !logged {
+			log.Printf("Error parsing image reference: %s\n", err)
+		}
+		return context.DockerImage{Repository: reference}
+	}
+	return context.DockerImage{
+		Registry:     ref.Registry,
+		Repository:   ref.Repository,
+		Tag:          ref.Tag,
+		Digest:       ref.Digest,
+		Domain:       ref.Domain(),
+		Path:         ref.Path(),
+		FamiliarName: ref.FamiliarName(),
+		Canonical:    ref.Canonical(),
+	}
+}
+
+// newImageInfo returns the details of an inspected image.
+func newImageInfo(image *docker.Image) *context.ImageInfo {
+	info := &context.ImageInfo{
+		ID:           image.ID,
+		RepoDigests:  image.RepoDigests,
+		Created:      image.Created,
+		Architecture: image.Architecture,
+		OS:           image.OS,
+	}
+	if image.Config == nil {
+		return info
+	}
+	info.Labels = image.Config.Labels
+	info.Env = utils.SplitKeyValueSlice(image.Config.Env)
+	for port := range image.Config.ExposedPorts {
+		info.ExposedPorts = append(info.ExposedPorts, string(port))
+	}
+	sort.Strings(info.ExposedPorts)
+	return info
+}
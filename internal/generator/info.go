@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"log"
+	"time"
+
+	"github.com/nginx-proxy/docker-gen/internal/context"
+	"github.com/nginx-proxy/docker-gen/internal/dockerclient"
+)
+
+// dockerInfoTTL is how long the information of the Docker daemon is cached.
+var dockerInfoTTL = 30 * time.Second
+
+// refreshServerInfo updates the information of the Docker daemon available to
+// templates, unless it was fetched less than dockerInfoTTL ago.
+func (g *generator) refreshServerInfo() {
+	g.infoMu.Lock()
+	defer g.infoMu.Unlock()
+	if time.Now().Before(g.infoExpires) {
+		return
+	}
+
+	client := dockerclient.NewAPIClient(g.Client)
+	info, err := client.Info()
+	if err != nil {
+		log.Printf("Error retrieving docker server info: %s\n", err)
+		return
+	}
+
+	swarm := context.DockerSwarm{
+		NodeID:         info.Swarm.NodeID,
+		NodeAddr:       info.Swarm.NodeAddr,
+		LocalNodeState: info.Swarm.LocalNodeState,
+	}
+	if info.Swarm.LocalNodeState == "active" {
+		swarm.Role = "worker"
+		if info.Swarm.ControlAvailable {
+			swarm.Role = "manager"
+		}
+	}
+	if info.Swarm.Cluster != nil {
+		swarm.ClusterID = info.Swarm.Cluster.ID
+	}
+	if info.Swarm.ControlAvailable {
+		node, err := client.InspectNode(info.Swarm.NodeID)
+		if err != nil {
+			log.Printf("Error inspecting swarm node %s: %s\n", info.Swarm.NodeID, err)
+		} else if node.ManagerStatus != nil {
+			swarm.Leader = node.ManagerStatus.Leader
+			swarm.Reachability = node.ManagerStatus.Reachability
+		}
+	}
+
+	context.SetServerInfo(&info.DockerInfo, swarm)
+	g.infoExpires = time.Now().Add(dockerInfoTTL)
+}
@@ -0,0 +1,567 @@
+package generator
+
+import (
+	"bytes"
+	gocontext "context"
+	"crypto/sha256"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/nginx-proxy/docker-gen/internal/config"
+	"github.com/nginx-proxy/docker-gen/internal/dockerclient"
+)
+
+// Labels with which containers matched by the filter of a signal step override its signal.
+const (
+	notifySignalLabel = "docker-gen.notify.signal"
+	notifyActionLabel = "docker-gen.notify.action"
+)
+
+// defaultStopTimeout is the time containers are given to stop before they are
+// killed by restart and stop steps without a timeout.
+const defaultStopTimeout = 10 * time.Second
+
+// notifyRetryDelay is the delay before the first retry of a failed notify
+// step, doubled on each subsequent retry.
+var notifyRetryDelay = time.Second
+
+// healthPollInterval is the interval at which containers are inspected while
+// waiting for them to be healthy.
+var healthPollInterval = time.Second
+
+// Notify step results per config name, published with expvar.
+var (
+	notifySucceeded = expvar.NewMap("notify_succeeded")
+	notifyFailed    = expvar.NewMap("notify_failed")
+)
+
+// notifications records the (container, action) pairs delivered during a
+// generation cycle, so that a container targeted by several configs is only
+// notified once per cycle. A nil notifications delivers every notification.
+type notifications map[string]bool
+
+func notificationKey(container, action string) string {
+	return container + "\x00" + action
+}
+
+// delivered reports whether action was already delivered to target.
+func (n notifications) delivered(target notifyTarget, action string) bool {
+	for _, name := range target.names() {
+		if n[notificationKey(name, action)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (n notifications) add(target notifyTarget, action string) {
+	if n == nil {
+		return
+	}
+	for _, name := range target.names() {
+		n[notificationKey(name, action)] = true
+	}
+}
+
+// notify runs the notification pipeline of a config, unless it is delayed by
+// notify_min_interval.
+func (g *generator) notify(cfg config.Config, result renderResult, sent notifications) {
+	if result.skipNotify {
+		log.Printf("Skipping notification of %s: requested by the template", cfg.DisplayName())
+		return
+	}
+	if cfg.NotifyMinInterval > 0 && !g.throttleNotify(cfg, result) {
+		return
+	}
+	g.deliverNotify(cfg, result, sent)
+}
+
+// deliverNotify runs the notification pipeline of a config, rolling the
+// destination back to its previous contents if a step fails and the config
+// asks for it.
+func (g *generator) deliverNotify(cfg config.Config, result renderResult, sent notifications) {
+	if err := g.runNotifySteps(cfg, result, sent); err != nil && cfg.RollbackOnNotifyFailure {
+		g.rollback(cfg, result)
+	}
+}
+
+// runNotifySteps runs the notification steps of a config in order, logging the
+// result of each one, and returns the first error. A failing step stops the
+// pipeline unless it continues on error.
+func (g *generator) runNotifySteps(cfg config.Config, result renderResult, sent notifications) error {
+	var firstErr error
+	steps := cfg.NotifySteps()
+	for _, request := range result.notify {
+		steps = append(steps, config.NotifyStep{
+			Type:            config.NotifySignal,
+			Containers:      []string{request.Container},
+			Signal:          request.Signal,
+			ContinueOnError: true,
+		})
+	}
+	for i, step := range steps {
+		err := g.runNotifyStepWithRetries(cfg, step, result, sent)
+		if err == nil {
+			notifySucceeded.Add(cfg.DisplayName(), 1)
+			log.Printf("Notify step %d/%d (%s) succeeded", i+1, len(steps), step)
+			continue
+		}
+		notifyFailed.Add(cfg.DisplayName(), 1)
+		log.Printf("Notify step %d/%d (%s) for %s failed: %s", i+1, len(steps), step, cfg.DisplayName(), err)
+		if firstErr == nil {
+			firstErr = fmt.Errorf("notify step %d/%d (%s): %w", i+1, len(steps), step, err)
+		}
+		if !step.ContinueOnError {
+			log.Printf("Skipping remaining notify steps for %s", cfg.DisplayName())
+			break
+		}
+	}
+	return firstErr
+}
+
+// rollback restores the contents replaced by result, marks the contents of
+// result as bad and notifies again.
+func (g *generator) rollback(cfg config.Config, result renderResult) {
+	if !result.changed {
+		// nothing was written, as for notifications on interval
+		return
+	}
+	if result.previous == nil {
+		log.Printf("Not rolling back %s: no previous contents", cfg.DisplayName())
+		return
+	}
+	dest, err := g.newDestination(cfg.Dest)
+	if err != nil || dest == nil {
+		return
+	}
+
+	state := g.state(cfg)
+	state.mu.Lock()
+	if !bytes.Equal(state.rendered, result.contents) {
+		state.mu.Unlock()
+		log.Printf("Not rolling back %s: it was generated again since", dest)
+		return
+	}
+	if err := dest.Write(result.previous); err != nil {
+		state.mu.Unlock()
+		log.Printf("Unable to roll back %s: %s", dest, err)
+		return
+	}
+	state.rendered = result.previous
+	state.bad = &badRender{hash: sha256.Sum256(result.contents), containers: state.containers}
+	state.mu.Unlock()
+
+	log.Printf("Rolled back %s to its previous contents after a notification failure", dest)
+	if err := g.runNotifySteps(cfg, renderResult{changed: true, contents: result.previous}, nil); err != nil {
+		log.Printf("Notification failed again after rolling back %s: %s", dest, err)
+	}
+}
+
+func (g *generator) runNotifyStepWithRetries(cfg config.Config, step config.NotifyStep, result renderResult, sent notifications) error {
+	for attempt := 0; ; attempt++ {
+		err := g.runNotifyStep(cfg, step, result, sent)
+		if err == nil || attempt >= step.Retries {
+			return err
+		}
+		delay := notifyRetryDelay << attempt
+		log.Printf("Notify step (%s) failed: %s. Retrying in %s (%d/%d)", step, err, delay, attempt+1, step.Retries)
+		time.Sleep(delay)
+	}
+}
+
+func (g *generator) runNotifyStep(cfg config.Config, step config.NotifyStep, result renderResult, sent notifications) error {
+	switch step.Type {
+	case config.NotifyCommand:
+		changes, err := json.Marshal(newPayloadContainers(result.changes))
+		if err != nil {
+			return err
+		}
+		env := notifyEnv(cfg, result)
+		if path, err := writeStateFile(cfg, ".changes.json", changes); err != nil {
+			log.Printf("Unable to write changes of %s: %s", cfg.DisplayName(), err)
+		} else {
+			env = append(env, "DOCKER_GEN_CHANGES="+path)
+		}
+		return g.runNotifyCmd(step, env, changes)
+	case config.NotifySignal:
+		signal, err := dockerclient.ParseSignal(step.Signal)
+		if err != nil {
+			return err
+		}
+		fallback := g.signalAction(signal)
+		return g.forEachTarget(step, sent, func(target notifyTarget) (containerAction, error) {
+			return g.labelAction(target, fallback)
+		})
+	case config.NotifyRestart:
+		return g.forEachTarget(step, sent, always(g.restartAction(step.Timeout)))
+	case config.NotifyStop:
+		return g.forEachTarget(step, sent, always(containerAction{"stop", func(container string) error {
+			log.Printf("Stopping container '%s'", container)
+			return g.Client.StopContainer(container, stopTimeout(step.Timeout))
+		}}))
+	case config.NotifyStart:
+		return g.forEachTarget(step, sent, always(containerAction{"start", func(container string) error {
+			log.Printf("Starting container '%s'", container)
+			return g.Client.StartContainer(container, nil)
+		}}))
+	case config.NotifyPause:
+		return g.forEachTarget(step, sent, always(containerAction{"pause", func(container string) error {
+			log.Printf("Pausing container '%s'", container)
+			return g.Client.PauseContainer(container)
+		}}))
+	case config.NotifyUnpause:
+		return g.forEachTarget(step, sent, always(containerAction{"unpause", func(container string) error {
+			log.Printf("Unpausing container '%s'", container)
+			return g.Client.UnpauseContainer(container)
+		}}))
+	case config.NotifyServiceUpdate:
+		var firstErr error
+		for _, service := range step.Services {
+			target := notifyTarget{container: service}
+			if sent.delivered(target, step.Type) {
+				log.Printf("Service '%s' was already updated in this cycle", service)
+				continue
+			}
+			if err := g.forceUpdateService(service); err != nil {
+				log.Printf("Error updating service '%s': %s", service, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			sent.add(target, step.Type)
+		}
+		return firstErr
+	case config.NotifyExec:
+		return g.forEachTarget(step, sent, always(g.execAction(step.Command, step.Timeout)))
+	case config.NotifyHTTP:
+		return postNotification(step, newNotifyPayload(cfg, result))
+	}
+	return fmt.Errorf("unknown notify type %q", step.Type)
+}
+
+// containerAction is a notification delivered to a container. Its name
+// identifies it when deduplicating notifications.
+type containerAction struct {
+	name string
+	run  func(container string) error
+}
+
+func always(action containerAction) func(notifyTarget) (containerAction, error) {
+	return func(notifyTarget) (containerAction, error) {
+		return action, nil
+	}
+}
+
+func (g *generator) signalAction(signal int) containerAction {
+	if signal == -1 {
+		return g.restartAction(0)
+	}
+	return containerAction{fmt.Sprintf("signal %d", signal), func(container string) error {
+		return g.sendSignalToContainer(container, signal)
+	}}
+}
+
+func (g *generator) restartAction(timeout time.Duration) containerAction {
+	return containerAction{"restart", func(container string) error {
+		return g.restartContainer(container, timeout)
+	}}
+}
+
+func (g *generator) execAction(command string, timeout time.Duration) containerAction {
+	return containerAction{"exec " + command, func(container string) error {
+		return g.execInContainer(container, command, timeout)
+	}}
+}
+
+// labelAction returns the action declared by the notifyActionLabel or
+// notifySignalLabel label of target, or fallback if it has neither.
+func (g *generator) labelAction(target notifyTarget, fallback containerAction) (containerAction, error) {
+	if value, ok := target.labels[notifyActionLabel]; ok {
+		kind, arg, _ := strings.Cut(value, ":")
+		switch kind {
+		case "signal":
+			signal, err := dockerclient.ParseSignal(arg)
+			if err != nil {
+				return containerAction{}, fmt.Errorf("invalid %s label: %w", notifyActionLabel, err)
+			}
+			return g.signalAction(signal), nil
+		case "restart":
+			return g.restartAction(0), nil
+		case "exec":
+			if arg == "" {
+				return containerAction{}, fmt.Errorf("invalid %s label %q: missing command", notifyActionLabel, value)
+			}
+			return g.execAction(arg, 0), nil
+		}
+		return containerAction{}, fmt.Errorf("invalid %s label %q: expected signal:<signal>, restart or exec:<command>", notifyActionLabel, value)
+	}
+
+	if value, ok := target.labels[notifySignalLabel]; ok {
+		signal, err := dockerclient.ParseSignal(value)
+		if err != nil {
+			return containerAction{}, fmt.Errorf("invalid %s label: %w", notifySignalLabel, err)
+		}
+		return g.signalAction(signal), nil
+	}
+	return fallback, nil
+}
+
+// forEachTarget runs the action returned by actionFor on every target
+// container of step that was not sent the same action yet, returning the first
+// error after all of them have been tried.
+func (g *generator) forEachTarget(step config.NotifyStep, sent notifications, actionFor func(notifyTarget) (containerAction, error)) error {
+	targets, err := g.notifyTargets(step)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, target := range targets {
+		action, err := actionFor(target)
+		if err == nil && sent.delivered(target, action.name) {
+			log.Printf("Container '%s' was already notified (%s) in this cycle", target.container, action.name)
+			continue
+		}
+		if err == nil {
+			err = action.run(target.container)
+		}
+		if err == nil && step.WaitHealthy > 0 {
+			err = g.waitHealthy(target.container, step.WaitHealthy)
+		}
+		if err != nil {
+			log.Printf("Error notifying container '%s': %s", target.container, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		sent.add(target, action.name)
+	}
+	return firstErr
+}
+
+// notifyTarget is a container to notify, addressed by name or ID, along with
+// the names it is also known by and, for containers matched by a filter, its labels.
+type notifyTarget struct {
+	container string
+	aliases   []string
+	labels    map[string]string
+}
+
+func (t notifyTarget) names() []string {
+	return append([]string{t.container}, t.aliases...)
+}
+
+// notifyTargets returns the containers listed by step followed by the running
+// containers matching its filter, addressed by ID.
+func (g *generator) notifyTargets(step config.NotifyStep) ([]notifyTarget, error) {
+	var targets []notifyTarget
+	for _, container := range step.Containers {
+		targets = append(targets, notifyTarget{container: container})
+	}
+	if len(step.Filter) == 0 {
+		return targets, nil
+	}
+
+	containers, err := g.Client.ListContainers(docker.ListContainersOptions{
+		Filters: step.Filter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting containers: %w", err)
+	}
+	for _, container := range containers {
+		target := notifyTarget{container: container.ID, labels: container.Labels}
+		for _, name := range container.Names {
+			target.aliases = append(target.aliases, strings.TrimPrefix(name, "/"))
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// configEnv returns the environment of docker-gen plus variables describing cfg.
+func configEnv(cfg config.Config) []string {
+	return append(os.Environ(),
+		"DOCKER_GEN_CONFIG="+cfg.DisplayName(),
+		"DOCKER_GEN_TEMPLATE="+cfg.Template,
+		"DOCKER_GEN_DEST="+cfg.Dest,
+	)
+}
+
+// notifyEnv returns the environment of notify commands: the environment of
+// the config plus variables describing the render.
+func notifyEnv(cfg config.Config, result renderResult) []string {
+	return append(configEnv(cfg),
+		"DOCKER_GEN_CHANGED="+strconv.FormatBool(result.changed),
+		"DOCKER_GEN_BACKUP="+result.backup,
+	)
+}
+
+// runNotifyCmd runs the command of step with /bin/sh -c and stdin as its
+// standard input, killing it after the step timeout. Its output is logged if
+// requested, and always when it fails.
+func (g *generator) runNotifyCmd(step config.NotifyStep, env []string, stdin []byte) error {
+	ctx := gocontext.Background()
+	if step.Timeout > 0 {
+		var cancel gocontext.CancelFunc
+		ctx, cancel = gocontext.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+
+	log.Printf("Running '%s'", step.Command)
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", step.Command)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(stdin)
+	// do not wait forever for background processes holding the output open
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if step.Output || err != nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if line != "" {
+				log.Printf("[%s]: %s", step.Command, line)
+			}
+		}
+	}
+	if ctx.Err() == gocontext.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", step.Timeout)
+	}
+	return err
+}
+
+func (g *generator) sendSignalToContainer(container string, signal int) error {
+	log.Printf("Sending container '%s' signal '%v'", container, signal)
+
+	if signal == -1 {
+		return g.restartContainer(container, 0)
+	}
+
+	killOpts := docker.KillContainerOptions{
+		ID:     container,
+		Signal: docker.Signal(signal),
+	}
+	return g.Client.KillContainer(killOpts)
+}
+
+func (g *generator) restartContainer(container string, timeout time.Duration) error {
+	log.Printf("Restarting container '%s'", container)
+	return g.Client.RestartContainer(container, stopTimeout(timeout))
+}
+
+// stopTimeout converts the timeout of a step to the seconds given to containers
+// to stop, defaulting to defaultStopTimeout.
+func stopTimeout(timeout time.Duration) uint {
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+	return uint(timeout.Round(time.Second) / time.Second)
+}
+
+// waitHealthy waits up to timeout for container to be healthy, or running if
+// it has no health check.
+func (g *generator) waitHealthy(container string, timeout time.Duration) error {
+	log.Printf("Waiting up to %s for container '%s' to be healthy", timeout, container)
+	deadline := time.Now().Add(timeout)
+	for {
+		c, err := g.Client.InspectContainer(container)
+		if err != nil {
+			return err
+		}
+		status := c.State.Health.Status
+		switch {
+		case status == "healthy", status == "" && c.State.Running:
+			return nil
+		case status == "":
+			status = c.State.StateString()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("container '%s' still %s after %s", container, status, timeout)
+		}
+		time.Sleep(healthPollInterval)
+	}
+}
+
+// forceUpdateService makes Swarm roll the tasks of service without changing
+// its spec, like docker service update --force.
+func (g *generator) forceUpdateService(service string) error {
+	log.Printf("Forcing update of service '%s'", service)
+	client := dockerclient.NewAPIClient(g.Client)
+	s, err := client.InspectService(service)
+	if err != nil {
+		return err
+	}
+	taskTemplate := serviceTaskTemplate(s.Spec)
+	var forceUpdate int64
+	if n, ok := taskTemplate["ForceUpdate"].(json.Number); ok {
+		forceUpdate, _ = n.Int64()
+	}
+	taskTemplate["ForceUpdate"] = forceUpdate + 1
+	return client.UpdateService(s.ID, s.Version.Index, s.Spec)
+}
+
+// execInContainer runs command with /bin/sh -c inside container, waits for it
+// to exit, at most timeout if set, and logs its output.
+func (g *generator) execInContainer(container, command string, timeout time.Duration) error {
+	ctx := gocontext.Background()
+	if timeout > 0 {
+		var cancel gocontext.CancelFunc
+		ctx, cancel = gocontext.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	log.Printf("Running '%s' in container '%s'", command, container)
+	exec, err := g.Client.CreateExec(docker.CreateExecOptions{
+		Container:    container,
+		Cmd:          []string{"/bin/sh", "-c", command},
+		AttachStdout: true,
+		AttachStderr: true,
+		Context:      ctx,
+	})
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	session, err := g.Client.StartExecNonBlocking(exec.ID, docker.StartExecOptions{
+		OutputStream: &out,
+		ErrorStream:  &out,
+		Context:      ctx,
+	})
+	if err != nil {
+		return err
+	}
+	// the attached session does not follow the context, it is closed instead
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Close()
+		return fmt.Errorf("'%s' timed out after %s in container '%s'", command, timeout, container)
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line != "" {
+			log.Printf("[%s@%s]: %s", command, container, line)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	inspect, err := g.Client.InspectExec(exec.ID)
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("'%s' exited with code %d in container '%s'", command, inspect.ExitCode, container)
+	}
+	return nil
+}
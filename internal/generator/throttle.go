@@ -0,0 +1,73 @@
+package generator
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/nginx-proxy/docker-gen/internal/config"
+)
+
+// throttleNotify enforces the notify_min_interval of cfg and reports whether
+// result can be notified now. Otherwise, result is coalesced into a pending
+// notification that is delivered once the interval has elapsed, so that the
+// final state is always notified.
+func (g *generator) throttleNotify(cfg config.Config, result renderResult) bool {
+	state := g.state(cfg)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.pending != nil {
+		merged := mergeResults(cfg, *state.pending, result)
+		state.pending = &merged
+		log.Printf("Suppressed notification of %s: coalesced into the pending one (notify_min_interval %s)", cfg.DisplayName(), cfg.NotifyMinInterval)
+		return false
+	}
+
+	wait := cfg.NotifyMinInterval - time.Since(state.lastNotified)
+	if wait <= 0 {
+		state.lastNotified = time.Now()
+		return true
+	}
+	state.pending = &result
+	time.AfterFunc(wait, func() { g.flushNotify(cfg) })
+	log.Printf("Delaying notification of %s by %s (notify_min_interval %s)", cfg.DisplayName(), wait.Round(time.Millisecond), cfg.NotifyMinInterval)
+	return false
+}
+
+// flushNotify delivers the pending notification of cfg.
+func (g *generator) flushNotify(cfg config.Config) {
+	state := g.state(cfg)
+	state.mu.Lock()
+	result := *state.pending
+	state.pending = nil
+	state.lastNotified = time.Now()
+	state.mu.Unlock()
+
+	log.Printf("Delivering delayed notification of %s", cfg.DisplayName())
+	g.deliverNotify(cfg, result, nil)
+}
+
+// mergeResults combines two consecutive renders of cfg into one describing
+// the change from before earlier to after later.
+func mergeResults(cfg config.Config, earlier, later renderResult) renderResult {
+	later.changed = earlier.changed || later.changed
+	later.changes = earlier.changes.Merge(later.changes)
+	later.skipNotify = earlier.skipNotify && later.skipNotify
+	for _, request := range earlier.notify {
+		if !slices.Contains(later.notify, request) {
+			later.notify = append(later.notify, request)
+		}
+	}
+	if earlier.previous != nil {
+		later.previous = earlier.previous
+		// the backup file was overwritten by the later render
+		backup, err := writeBackup(cfg, earlier.previous)
+		if err != nil {
+			log.Printf("Unable to back up previous contents of %s: %s\n", cfg.DisplayName(), err)
+			backup = ""
+		}
+		later.backup = backup
+	}
+	return later
+}
@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"bytes"
+	gocontext "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/nginx-proxy/docker-gen/internal/config"
+	"github.com/nginx-proxy/docker-gen/internal/context"
+)
+
+// defaultNotifyHTTPTimeout applies to http steps without a timeout.
+const defaultNotifyHTTPTimeout = 10 * time.Second
+
+// notifyPayload is the JSON body posted by http notify steps.
+type notifyPayload struct {
+	Config     string            `json:"config"`
+	Template   string            `json:"template"`
+	Dest       string            `json:"dest"`
+	Hash       string            `json:"hash"`
+	Changed    bool              `json:"changed"`
+	Containers payloadContainers `json:"containers"`
+}
+
+type payloadContainers struct {
+	Added   []payloadContainer `json:"added"`
+	Removed []payloadContainer `json:"removed"`
+	Changed []payloadContainer `json:"changed"`
+}
+
+type payloadContainer struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+func newNotifyPayload(cfg config.Config, result renderResult) notifyPayload {
+	sum := sha256.Sum256(result.contents)
+	return notifyPayload{
+		Config:     cfg.DisplayName(),
+		Template:   cfg.Template,
+		Dest:       cfg.Dest,
+		Hash:       "sha256:" + hex.EncodeToString(sum[:]),
+		Changed:    result.changed,
+		Containers: newPayloadContainers(result.changes),
+	}
+}
+
+// newPayloadContainers describes changes in the JSON format shared by http
+// steps and notify commands.
+func newPayloadContainers(changes context.Changes) payloadContainers {
+	return payloadContainers{
+		Added:   newPayloadContainerList(changes.Added),
+		Removed: newPayloadContainerList(changes.Removed),
+		Changed: newPayloadContainerList(changes.Changed),
+	}
+}
+
+func newPayloadContainerList(refs []context.ContainerRef) []payloadContainer {
+	containers := make([]payloadContainer, 0, len(refs))
+	for _, ref := range refs {
+		containers = append(containers, payloadContainer{ID: ref.ID, Name: ref.Name, Fields: ref.Fields})
+	}
+	return containers
+}
+
+// postNotification posts payload to the URL of an http step, through its
+// unix socket if it has one.
+func postNotification(step config.NotifyStep, payload notifyPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, step.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range step.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	client := &http.Client{Timeout: step.Timeout}
+	if client.Timeout <= 0 {
+		client.Timeout = defaultNotifyHTTPTimeout
+	}
+	if step.Socket != "" {
+		client.Transport = &http.Transport{
+			DialContext: func(ctx gocontext.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", step.Socket)
+			},
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s responded with %s: %s", step.URL, resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
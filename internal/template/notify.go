@@ -0,0 +1,49 @@
+package template
+
+import (
+	"slices"
+	"text/template"
+
+	"github.com/nginx-proxy/docker-gen/internal/dockerclient"
+)
+
+// ContainerNotification is a signal a template asked to send to a container
+// once the generated contents are written.
+type ContainerNotification struct {
+	Container string
+	Signal    string
+}
+
+// notifications collects the notification requests made by a template while
+// it is executed.
+type notifications struct {
+	containers []ContainerNotification
+	skip       bool
+}
+
+func (n *notifications) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"notifyContainer": n.notifyContainer,
+		"notifySkip":      n.notifySkip,
+	}
+}
+
+// notifyContainer requests sending signal, by name or number, or -1 to
+// restart, to container after the contents are written.
+func (n *notifications) notifyContainer(container, signal string) (string, error) {
+	if _, err := dockerclient.ParseSignal(signal); err != nil {
+		return "", err
+	}
+	request := ContainerNotification{Container: container, Signal: signal}
+	if !slices.Contains(n.containers, request) {
+		n.containers = append(n.containers, request)
+	}
+	return "", nil
+}
+
+// notifySkip requests skipping the notifications of this render, for
+// changes that need no reload.
+func (n *notifications) notifySkip() string {
+	n.skip = true
+	return ""
+}
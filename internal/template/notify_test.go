@@ -0,0 +1,44 @@
+package template
+
+import (
+	"os"
+	"testing"
+
+	"github.com/nginx-proxy/docker-gen/internal/config"
+	"github.com/nginx-proxy/docker-gen/internal/context"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateNotifications(t *testing.T) {
+	dir := t.TempDir()
+	render := func(tmpl string) (Output, error) {
+		tmplPath := dir + "/notify.tmpl"
+		if err := os.WriteFile(tmplPath, []byte(tmpl), 0644); err != nil {
+			t.Fatal(err)
+		}
+		containers := context.Context{
+			{Name: "web", Labels: map[string]string{"proxy": "nginx"}},
+			{Name: "api", Labels: map[string]string{"proxy": "nginx"}},
+			{Name: "db", Labels: map[string]string{"proxy": "haproxy"}},
+		}
+		return Render(config.Config{Template: tmplPath}, containers, context.RenderData{})
+	}
+
+	output, err := render(`{{ range $ }}{{ notifyContainer .Labels.proxy "SIGHUP" }}{{ .Name }};{{ end }}{{ notifyContainer "envoy" "-1" }}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "web;api;db;", string(output.Contents))
+	assert.Equal(t, []ContainerNotification{
+		{Container: "nginx", Signal: "SIGHUP"},
+		{Container: "haproxy", Signal: "SIGHUP"},
+		{Container: "envoy", Signal: "-1"},
+	}, output.Notify)
+	assert.False(t, output.SkipNotify)
+
+	output, err = render(`{{ if eq (len $) 3 }}{{ notifySkip }}{{ end }}comment only`)
+	assert.NoError(t, err)
+	assert.Equal(t, "comment only", string(output.Contents))
+	assert.True(t, output.SkipNotify)
+
+	_, err = render(`{{ notifyContainer "nginx" "SIGFOO" }}`)
+	assert.Error(t, err)
+}
@@ -6,10 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
-	"log"
 	"net/url"
-	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
@@ -158,47 +155,50 @@ func removeBlankLines(reader io.Reader, writer io.Writer) {
 	bwriter.Flush()
 }
 
-func GenerateFile(config config.Config, containers context.Context) bool {
-	contents := executeTemplate(config.Template, containers)
+// Output is the result of rendering a config template.
+type Output struct {
+	Contents []byte
+	// Notify lists the notifications requested with notifyContainer.
+	Notify []ContainerNotification
+	// SkipNotify is set when the template called notifySkip.
+	SkipNotify bool
+}
 
-	if !config.KeepBlankLines {
-		buf := new(bytes.Buffer)
-		removeBlankLines(bytes.NewReader(contents), buf)
-		contents = buf.Bytes()
+// Render executes the config template against containers and data. The
+// contents have blank lines removed unless KeepBlankLines is set.
+func Render(config config.Config, containers context.Context, data context.RenderData) (Output, error) {
+	output, err := executeTemplate(config.Template, containers, data)
+	if err != nil {
+		return Output{}, err
 	}
 
-	if config.Dest != "" {
-		oldContents, err := os.ReadFile(config.Dest)
-		if err != nil && !errors.Is(err, fs.ErrNotExist) {
-			log.Fatalf("Unable to compare current file contents: %s: %s\n", config.Dest, err)
-		}
-
-		if !bytes.Equal(oldContents, contents) {
-			err := os.WriteFile(config.Dest, contents, 0644)
-			if err != nil {
-				log.Fatalf("Unable to write to dest file %s: %s\n", config.Dest, err)
-			}
-			log.Printf("Generated '%s' from %d containers", config.Dest, len(containers))
-			return true
-		}
-		return false
-	} else {
-		os.Stdout.Write(contents)
+	if !config.KeepBlankLines {
+		buf := new(bytes.Buffer)
+		removeBlankLines(bytes.NewReader(output.Contents), buf)
+		output.Contents = buf.Bytes()
 	}
-	return true
+	return output, nil
 }
 
-func executeTemplate(templatePath string, containers context.Context) []byte {
+func executeTemplate(templatePath string, containers context.Context, data context.RenderData) (Output, error) {
+	var notifications notifications
 	templatePathList := strings.Split(templatePath, ";")
-	tmpl, err := newTemplate(filepath.Base(templatePath)).ParseFiles(templatePathList...)
+	tmpl, err := newTemplate(filepath.Base(templatePath)).Funcs(notifications.funcMap()).ParseFiles(templatePathList...)
 	if err != nil {
-		log.Fatalf("Unable to parse template: %s", err)
+		return Output{}, fmt.Errorf("unable to parse template: %w", err)
 	}
 
+	ctx := &containers
+	defer ctx.Bind(data)()
+
 	buf := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(buf, filepath.Base(templatePathList[0]), &containers)
+	err = tmpl.ExecuteTemplate(buf, filepath.Base(templatePathList[0]), ctx)
 	if err != nil {
-		log.Fatalf("Template error: %s\n", err)
+		return Output{}, fmt.Errorf("template error: %w", err)
 	}
-	return buf.Bytes()
+	return Output{
+		Contents:   buf.Bytes(),
+		Notify:     notifications.containers,
+		SkipNotify: notifications.skip,
+	}, nil
 }
@@ -3,11 +3,14 @@ package template
 import (
 	"bytes"
 	"errors"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/nginx-proxy/docker-gen/internal/config"
+	"github.com/nginx-proxy/docker-gen/internal/context"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -193,3 +196,63 @@ func TestEval(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderChanges(t *testing.T) {
+	tmplPath := t.TempDir() + "/changes.tmpl"
+	tmpl := `{{ range .Changes.Added }}+{{ .Name }} {{ end }}{{ range .Changes.Changed }}~{{ .Name }}({{ join "," .Fields }}) {{ end }}{{ len $ }}`
+	if err := os.WriteFile(tmplPath, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	containers := context.Context{{ID: "1", Name: "web"}, {ID: "2", Name: "api"}}
+	changes := context.Changes{
+		Added:   []context.ContainerRef{{ID: "1", Name: "web"}},
+		Changed: []context.ContainerRef{{ID: "2", Name: "api", Fields: []string{"Env", "State"}}},
+	}
+	cfg := config.Config{Template: tmplPath}
+
+	output, err := Render(cfg, containers, context.RenderData{Changes: changes})
+	assert.NoError(t, err)
+	assert.Equal(t, "+web ~api(Env,State) 2", string(output.Contents))
+	output, err = Render(cfg, containers, context.RenderData{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", string(output.Contents))
+}
+
+func TestRenderCompareImages(t *testing.T) {
+	tmplPath := t.TempDir() + "/images.tmpl"
+	tmpl := `{{ $a := index $ 0 }}{{ $b := index $ 1 }}{{ eq $a.Image $b.Image }}`
+	if err := os.WriteFile(tmplPath, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	image := context.DockerImage{Repository: "nginx", Tag: "1.27"}
+	containers := context.Context{
+		{ID: "1", Image: image, ImageDetails: &context.ImageInfo{ID: "sha256:1", Labels: map[string]string{"a": "b"}}},
+		{ID: "2", Image: image},
+	}
+
+	output, err := Render(config.Config{Template: tmplPath}, containers, context.RenderData{})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", string(output.Contents))
+}
+
+func TestRenderErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		tmpl string
+		err  string
+	}{
+		{`{{ .Missing }`, "unable to parse template"},
+		{`{{ fail "boom" }}`, "template error"},
+	} {
+		tmplPath := dir + "/error.tmpl"
+		if err := os.WriteFile(tmplPath, []byte(tc.tmpl), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Render(config.Config{Template: tmplPath}, context.Context{}, context.RenderData{})
+		assert.ErrorContains(t, err, tc.err)
+	}
+	_, err := Render(config.Config{Template: dir + "/missing.tmpl"}, context.Context{}, context.RenderData{})
+	assert.ErrorContains(t, err, "unable to parse template")
+}